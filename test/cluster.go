@@ -0,0 +1,348 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+var (
+	clusterCacheMu sync.Mutex
+	clusterCache   = map[string]string{}
+)
+
+// cachedCluster returns the cluster property key, calling resolve until it's
+// successfully resolved once in the run. The lock isn't held while resolving,
+// as resolvers depend on other cached properties.
+func cachedCluster(key string, resolve func() (string, error)) (string, error) {
+	clusterCacheMu.Lock()
+	value, ok := clusterCache[key]
+	clusterCacheMu.Unlock()
+	if ok {
+		return value, nil
+	}
+	value, err := resolve()
+	if nil != err {
+		return "", err
+	}
+	clusterCacheMu.Lock()
+	clusterCache[key] = value
+	clusterCacheMu.Unlock()
+	return value, nil
+}
+
+// kubeconfigCluster returns the kubeconfig name of the cluster under test,
+// -cluster or the cluster of the current context.
+func kubeconfigCluster() (string, error) {
+	return cachedCluster("kubeconfig", func() (string, error) {
+		if "" != Flags.Cluster {
+			return Flags.Cluster, nil
+		}
+		name, err := runCommand(context.Background(), nil, "kubectl", "config", "view", "--minify", "-o", "jsonpath={.clusters[0].name}")
+		if nil == err && "" == name {
+			err = fmt.Errorf("no current cluster in kubeconfig")
+		}
+		return name, err
+	})
+}
+
+// gkeCluster splits the kubeconfig name gcloud gives to GKE clusters,
+// gke_<project>_<location>_<name>.
+func gkeCluster() (project, location, name string, err error) {
+	cluster, err := kubeconfigCluster()
+	if nil != err {
+		return "", "", "", err
+	}
+	parts := strings.SplitN(cluster, "_", 4)
+	if 4 != len(parts) || "gke" != parts[0] {
+		return "", "", "", fmt.Errorf("cluster '%s' is not named like a GKE cluster", cluster)
+	}
+	return parts[1], parts[2], parts[3], nil
+}
+
+// bestEffort returns value and err, unless -besteffort is set in which case
+// a failure to resolve what is logged and an empty value returned instead.
+func bestEffort(what, value string, err error) (string, error) {
+	if nil != err && Flags.BestEffortResolution {
+		log.Printf("Warning: failed resolving %s, using an empty value: %v", what, err)
+		return "", nil
+	}
+	return value, err
+}
+
+// GetClusterName returns the name of the cluster under test.
+func GetClusterName() (string, error) {
+	name, err := clusterName()
+	return bestEffort("the cluster name", name, err)
+}
+
+func clusterName() (string, error) {
+	return cachedCluster("name", func() (string, error) {
+		if gkeProvider == Flags.Provider {
+			_, _, name, err := gkeCluster()
+			return name, err
+		}
+		return kubeconfigCluster()
+	})
+}
+
+// ClusterName is GetClusterName for test setup code, it exits the test binary
+// if the name can't be resolved, unless -besteffort is set.
+func ClusterName() string {
+	name, err := GetClusterName()
+	if nil != err {
+		log.Fatalf("Failed resolving the cluster name: %v", err)
+	}
+	return name
+}
+
+// GetClusterRegion returns the region, or zone, of the GKE cluster under test.
+func GetClusterRegion() (string, error) {
+	region, err := clusterRegion()
+	return bestEffort("the cluster region", region, err)
+}
+
+func clusterRegion() (string, error) {
+	if gkeProvider != Flags.Provider {
+		return "", errUnsupportedProvider("resolving the cluster region")
+	}
+	return cachedCluster("region", func() (string, error) {
+		_, location, _, err := gkeCluster()
+		return location, err
+	})
+}
+
+// GetClusterProject returns the GCP project of the GKE cluster under test.
+func GetClusterProject() (string, error) {
+	project, err := clusterProject()
+	return bestEffort("the cluster project", project, err)
+}
+
+func clusterProject() (string, error) {
+	if gkeProvider != Flags.Provider {
+		return "", errUnsupportedProvider("resolving the cluster project")
+	}
+	return cachedCluster("project", func() (string, error) {
+		project, _, _, err := gkeCluster()
+		return project, err
+	})
+}
+
+// GetServerVersion returns the Kubernetes version of the cluster under test,
+// e.g. v1.15.4-gke.22.
+func GetServerVersion() (string, error) {
+	version, err := serverVersion()
+	return bestEffort("the cluster version", version, err)
+}
+
+func serverVersion() (string, error) {
+	return cachedCluster("version", func() (string, error) {
+		out, err := kubectl(context.Background(), "version", "-o", "json")
+		if nil != err {
+			return "", err
+		}
+		var version struct {
+			ServerVersion struct {
+				GitVersion string `json:"gitVersion"`
+			} `json:"serverVersion"`
+		}
+		if err = json.Unmarshal([]byte(out), &version); nil != err {
+			return "", fmt.Errorf("failed parsing kubectl version: %v", err)
+		}
+		return version.ServerVersion.GitVersion, nil
+	})
+}
+
+// DescribeClusterField returns the given field of `gcloud container clusters
+// describe` for the GKE cluster under test, e.g. "currentMasterVersion".
+func DescribeClusterField(field string) (string, error) {
+	value, err := describeClusterField(field)
+	return bestEffort("the cluster "+field, value, err)
+}
+
+func describeClusterField(field string) (string, error) {
+	if gkeProvider != Flags.Provider {
+		return "", errUnsupportedProvider("describing the cluster")
+	}
+	return cachedCluster("describe/"+field, func() (string, error) {
+		project, location, name, err := gkeCluster()
+		if nil != err {
+			return "", err
+		}
+		// Zones are regions suffixed with the zone letter, e.g. us-central1-a
+		locationFlag := "--region"
+		if 2 == strings.Count(location, "-") {
+			locationFlag = "--zone"
+		}
+		return gcloud(context.Background(), "container", "clusters", "describe", name,
+			"--project", project, locationFlag, location, fmt.Sprintf("--format=value(%s)", field))
+	})
+}
+
+// GetOIDCIssuer returns the URL of the OIDC issuer of the service account
+// tokens of the cluster under test, read from its discovery document. GKE
+// clusters not serving it fall back to their selfLink, which is their issuer.
+func GetOIDCIssuer() (string, error) {
+	out, err := kubectl(context.Background(), "get", "--raw", "/.well-known/openid-configuration")
+	if nil == err {
+		var config struct {
+			Issuer string `json:"issuer"`
+		}
+		if err = json.Unmarshal([]byte(out), &config); nil == err && "" == config.Issuer {
+			err = fmt.Errorf("no issuer in the OIDC discovery document")
+		}
+		if nil == err {
+			return config.Issuer, nil
+		}
+	}
+	if gkeProvider != Flags.Provider {
+		return "", fmt.Errorf("failed resolving the OIDC issuer: %v", err)
+	}
+	return DescribeClusterField("selfLink")
+}
+
+// DefaultStorageClass returns the name of the StorageClass annotated as the
+// default one of the cluster under test, used by claims not naming a class.
+func DefaultStorageClass() (string, error) {
+	return cachedCluster("storageclass", func() (string, error) {
+		out, err := kubectl(context.Background(), "get", "storageclass", "-o",
+			`jsonpath={range .items[*]}{.metadata.name}{"\t"}{.metadata.annotations.storageclass\.kubernetes\.io/is-default-class}{"\n"}{end}`)
+		if nil != err {
+			return "", err
+		}
+		var defaults []string
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.Fields(line)
+			if 2 == len(fields) && "true" == fields[1] {
+				defaults = append(defaults, fields[0])
+			}
+		}
+		switch len(defaults) {
+		case 0:
+			return "", fmt.Errorf("no default StorageClass in the cluster")
+		case 1:
+			return defaults[0], nil
+		default:
+			return "", fmt.Errorf("ambiguous default StorageClass, all of %s are annotated as default", strings.Join(defaults, ", "))
+		}
+	})
+}
+
+// ClusterHasAPIResource tells whether the cluster under test serves the kind
+// in the API group/version, e.g. HTTPRoute in gateway.networking.k8s.io/v1.
+// The group is empty for the core API. Discovery results are cached.
+func ClusterHasAPIResource(group, version, kind string) (bool, error) {
+	path := "/apis/" + group + "/" + version
+	if "" == group {
+		path = "/api/" + version
+	}
+	out, err := cachedCluster("discovery"+path, func() (string, error) {
+		out, err := kubectl(context.Background(), "get", "--raw", path)
+		if nil != err && strings.Contains(err.Error(), "NotFound") {
+			// The group version isn't served at all
+			return "", nil
+		}
+		return out, err
+	})
+	if nil != err || "" == out {
+		return false, err
+	}
+	var resources struct {
+		Resources []struct {
+			Kind string `json:"kind"`
+		} `json:"resources"`
+	}
+	if err = json.Unmarshal([]byte(out), &resources); nil != err {
+		return false, fmt.Errorf("failed parsing discovery of %s: %v", path, err)
+	}
+	for _, r := range resources.Resources {
+		if kind == r.Kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ClusterFingerprint returns a stable hash identifying the cluster under
+// test, by its provider, name, region, project and Kubernetes version.
+func ClusterFingerprint() (string, error) {
+	name, err := clusterName()
+	if nil != err {
+		return "", err
+	}
+	version, err := serverVersion()
+	if nil != err {
+		return "", err
+	}
+	var region, project string
+	if gkeProvider == Flags.Provider {
+		if region, err = clusterRegion(); nil != err {
+			return "", err
+		}
+		if project, err = clusterProject(); nil != err {
+			return "", err
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "provider=%s\ncluster=%s\nregion=%s\nproject=%s\nversion=%s\n",
+		Flags.Provider, name, region, project, version)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// GetClusterCIDRs returns the ranges of the pod and service IPs of the
+// cluster under test. On GKE they're described by gcloud, on other clusters
+// they're read from the flags of kube-controller-manager when it runs as a
+// pod, the pod range falling back to the one allocated to the first node.
+func GetClusterCIDRs() (podCIDR, serviceCIDR string, err error) {
+	if gkeProvider == Flags.Provider {
+		if podCIDR, err = DescribeClusterField("clusterIpv4Cidr"); nil != err {
+			return "", "", err
+		}
+		serviceCIDR, err = DescribeClusterField("servicesIpv4Cidr")
+		return podCIDR, serviceCIDR, err
+	}
+	ctx := context.Background()
+	out, err := kubectl(ctx, "get", "pods", "-n", "kube-system", "-l", "component=kube-controller-manager",
+		"-o", "jsonpath={.items[*].spec.containers[*].command[*]}")
+	if nil != err {
+		return "", "", err
+	}
+	for _, arg := range strings.Fields(out) {
+		switch {
+		case strings.HasPrefix(arg, "--cluster-cidr="):
+			podCIDR = strings.TrimPrefix(arg, "--cluster-cidr=")
+		case strings.HasPrefix(arg, "--service-cluster-ip-range="):
+			serviceCIDR = strings.TrimPrefix(arg, "--service-cluster-ip-range=")
+		}
+	}
+	if "" == podCIDR {
+		if podCIDR, err = kubectl(ctx, "get", "nodes", "-o", "jsonpath={.items[0].spec.podCIDR}"); nil != err {
+			return "", "", err
+		}
+	}
+	if "" == podCIDR || "" == serviceCIDR {
+		return "", "", fmt.Errorf("resolving the cluster CIDRs is unsupported on provider '%s' without a kube-controller-manager pod, got pod CIDR '%s' and service CIDR '%s'",
+			Flags.Provider, podCIDR, serviceCIDR)
+	}
+	return podCIDR, serviceCIDR, nil
+}
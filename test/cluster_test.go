@@ -0,0 +1,304 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// resetClusterCache forgets every cluster property resolved so far.
+func resetClusterCache() {
+	clusterCacheMu.Lock()
+	defer clusterCacheMu.Unlock()
+	clusterCache = map[string]string{}
+}
+
+// fakeCluster makes the resolvers see a cluster with the given kubeconfig name
+// and Kubernetes version.
+func fakeCluster(provider, kubeconfigName, version string) (*fakeRunner, func()) {
+	resetClusterCache()
+	restoreFlags := saveFlags()
+	Flags.Provider = provider
+	Flags.Cluster = kubeconfigName
+	f, restoreRunner := useFakeRunner(fakeResult{out: `{"serverVersion":{"gitVersion":"` + version + `"}}`})
+	return f, func() {
+		restoreRunner()
+		restoreFlags()
+		resetClusterCache()
+	}
+}
+
+func TestGKEClusterResolvers(t *testing.T) {
+	_, restore := fakeCluster("gke", "gke_my-project_us-central1_knative-e2e", "v1.15.4-gke.22")
+	defer restore()
+
+	if got, err := GetClusterName(); nil != err || "knative-e2e" != got {
+		t.Errorf("GetClusterName() = '%s', %v, want 'knative-e2e'", got, err)
+	}
+	if got, err := GetClusterRegion(); nil != err || "us-central1" != got {
+		t.Errorf("GetClusterRegion() = '%s', %v, want 'us-central1'", got, err)
+	}
+	if got, err := GetClusterProject(); nil != err || "my-project" != got {
+		t.Errorf("GetClusterProject() = '%s', %v, want 'my-project'", got, err)
+	}
+	if got, err := GetServerVersion(); nil != err || "v1.15.4-gke.22" != got {
+		t.Errorf("GetServerVersion() = '%s', %v, want 'v1.15.4-gke.22'", got, err)
+	}
+}
+
+func TestDescribeClusterField(t *testing.T) {
+	for _, tc := range []struct {
+		location string
+		flag     string
+	}{
+		{"us-central1", "--region"},
+		{"us-central1-a", "--zone"},
+	} {
+		f, restore := fakeCluster("gke", "gke_my-project_"+tc.location+"_knative-e2e", "")
+		f.results = []fakeResult{{out: "1.15.4-gke.22"}}
+		got, err := DescribeClusterField("currentMasterVersion")
+		restore()
+		if nil != err || "1.15.4-gke.22" != got {
+			t.Errorf("%s: DescribeClusterField() = '%s', %v, want '1.15.4-gke.22'", tc.location, got, err)
+		}
+		want := "gcloud container clusters describe knative-e2e --project my-project " + tc.flag + " " + tc.location +
+			" --format=value(currentMasterVersion)"
+		if got := f.calls[0].String(); want != got {
+			t.Errorf("%s: got command '%s', want '%s'", tc.location, got, want)
+		}
+	}
+}
+
+func TestClusterFingerprintUnresolvedName(t *testing.T) {
+	_, restore := fakeCluster("gke", "minikube", "v1.15.4")
+	defer restore()
+	if _, err := ClusterFingerprint(); nil == err {
+		t.Error("Expected an error when the cluster name can't be resolved, got nil")
+	}
+}
+
+func TestClusterFingerprint(t *testing.T) {
+	fingerprint := func(provider, cluster, version string) string {
+		_, restore := fakeCluster(provider, cluster, version)
+		defer restore()
+		fp, err := ClusterFingerprint()
+		if nil != err {
+			t.Fatalf("Failed computing the fingerprint of %s: %v", cluster, err)
+		}
+		return fp
+	}
+
+	base := fingerprint("gke", "gke_my-project_us-central1_knative-e2e", "v1.15.4")
+	if again := fingerprint("gke", "gke_my-project_us-central1_knative-e2e", "v1.15.4"); base != again {
+		t.Errorf("Expected a stable fingerprint, got '%s' then '%s'", base, again)
+	}
+	for _, tc := range []struct {
+		provider string
+		cluster  string
+		version  string
+	}{
+		{"gke", "gke_other-project_us-central1_knative-e2e", "v1.15.4"},
+		{"gke", "gke_my-project_us-east1_knative-e2e", "v1.15.4"},
+		{"gke", "gke_my-project_us-central1_other-cluster", "v1.15.4"},
+		{"gke", "gke_my-project_us-central1_knative-e2e", "v1.16.0"},
+		{"kind", "gke_my-project_us-central1_knative-e2e", "v1.15.4"},
+	} {
+		if fp := fingerprint(tc.provider, tc.cluster, tc.version); base == fp {
+			t.Errorf("Expected fingerprint to change for %+v", tc)
+		}
+	}
+}
+
+func TestGetOIDCIssuer(t *testing.T) {
+	f, restore := fakeCluster("kind", "kind-kind", "")
+	defer restore()
+	f.results = []fakeResult{{out: `{"issuer":"https://kubernetes.default.svc.cluster.local","jwks_uri":"https://10.0.0.1/openid/v1/jwks"}`}}
+
+	if got, err := GetOIDCIssuer(); nil != err || "https://kubernetes.default.svc.cluster.local" != got {
+		t.Errorf("GetOIDCIssuer() = '%s', %v, want 'https://kubernetes.default.svc.cluster.local'", got, err)
+	}
+	if want := "kubectl --cluster kind-kind get --raw /.well-known/openid-configuration"; want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+}
+
+func TestGetOIDCIssuerGKEFallback(t *testing.T) {
+	f, restore := fakeCluster("gke", "gke_my-project_us-central1_knative-e2e", "")
+	defer restore()
+	selfLink := "https://container.googleapis.com/v1/projects/my-project/locations/us-central1/clusters/knative-e2e"
+	f.results = []fakeResult{{err: exitErr(1, "Error from server (NotFound)")}, {out: selfLink}}
+
+	if got, err := GetOIDCIssuer(); nil != err || selfLink != got {
+		t.Errorf("GetOIDCIssuer() = '%s', %v, want '%s'", got, err, selfLink)
+	}
+	if got := f.calls[1].String(); !strings.HasSuffix(got, "--format=value(selfLink)") {
+		t.Errorf("Expected a fallback to describing the cluster, got '%s'", got)
+	}
+}
+
+func TestDefaultStorageClass(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		out     string
+		want    string
+		wantErr bool
+	}{
+		{"single default", "premium-rwo\t\nstandard\ttrue\nstandard-rwo\tfalse", "standard", false},
+		{"no default", "premium-rwo\t\nstandard\tfalse", "", true},
+		{"multiple defaults", "premium-rwo\ttrue\nstandard\ttrue", "", true},
+	} {
+		f, restore := fakeCluster("gke", "gke_my-project_us-central1_knative-e2e", "")
+		f.results = []fakeResult{{out: tc.out}}
+		got, err := DefaultStorageClass()
+		// The result is cached
+		if nil == err {
+			DefaultStorageClass()
+		}
+		calls := len(f.calls)
+		restore()
+		if tc.want != got || (nil != err) != tc.wantErr {
+			t.Errorf("%s: DefaultStorageClass() = '%s', %v, want '%s' with error=%v", tc.name, got, err, tc.want, tc.wantErr)
+		}
+		if 1 != calls {
+			t.Errorf("%s: expected a single kubectl call, got %d", tc.name, calls)
+		}
+	}
+}
+
+func TestClusterHasAPIResource(t *testing.T) {
+	discovery := `{"kind":"APIResourceList","groupVersion":"gateway.networking.k8s.io/v1",` +
+		`"resources":[{"name":"gateways","kind":"Gateway"},{"name":"httproutes","kind":"HTTPRoute"}]}`
+	for _, tc := range []struct {
+		name    string
+		result  fakeResult
+		kind    string
+		want    bool
+		wantErr bool
+	}{
+		{"present", fakeResult{out: discovery}, "HTTPRoute", true, false},
+		{"absent kind", fakeResult{out: discovery}, "GRPCRoute", false, false},
+		{"absent group", fakeResult{err: exitErr(1, "Error from server (NotFound): the server could not find the requested resource")}, "HTTPRoute", false, false},
+		{"discovery error", fakeResult{err: exitErr(1, "Unable to connect to the server")}, "HTTPRoute", false, true},
+	} {
+		f, restore := fakeCluster("kind", "kind-kind", "")
+		f.results = []fakeResult{tc.result}
+		got, err := ClusterHasAPIResource("gateway.networking.k8s.io", "v1", tc.kind)
+		restore()
+		if tc.want != got || (nil != err) != tc.wantErr {
+			t.Errorf("%s: got %v, %v, want %v with error=%v", tc.name, got, err, tc.want, tc.wantErr)
+		}
+		if want := "kubectl --cluster kind-kind get --raw /apis/gateway.networking.k8s.io/v1"; want != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], want)
+		}
+	}
+}
+
+func TestClusterHasAPIResourceCached(t *testing.T) {
+	f, restore := fakeCluster("kind", "kind-kind", "")
+	defer restore()
+	f.results = []fakeResult{{out: `{"resources":[{"name":"pods","kind":"Pod"},{"name":"services","kind":"Service"}]}`}}
+
+	for _, kind := range []string{"Pod", "Service"} {
+		if got, err := ClusterHasAPIResource("", "v1", kind); nil != err || !got {
+			t.Errorf("Expected core kind %s to be served, got %v, %v", kind, got, err)
+		}
+	}
+	if want := []string{"kubectl --cluster kind-kind get --raw /api/v1"}; !reflect.DeepEqual(f.commands(), want) {
+		t.Errorf("Expected a single discovery call, got %v", f.commands())
+	}
+}
+
+func TestBestEffortResolution(t *testing.T) {
+	for _, bestEffort := range []bool{false, true} {
+		f, restore := fakeCluster("gke", "", "")
+		Flags.BestEffortResolution = bestEffort
+		f.results = []fakeResult{{err: exitErr(1, "Unable to connect to the server")}}
+
+		for name, resolve := range map[string]func() (string, error){
+			"GetClusterName":       GetClusterName,
+			"GetClusterRegion":     GetClusterRegion,
+			"GetClusterProject":    GetClusterProject,
+			"GetServerVersion":     GetServerVersion,
+			"DescribeClusterField": func() (string, error) { return DescribeClusterField("selfLink") },
+		} {
+			got, err := resolve()
+			if "" != got || (nil != err) == bestEffort {
+				t.Errorf("%s with -besteffort=%v: got '%s', %v", name, bestEffort, got, err)
+			}
+		}
+		if bestEffort {
+			if got := ClusterName(); "" != got {
+				t.Errorf("ClusterName() with -besteffort = '%s', want ''", got)
+			}
+		}
+		restore()
+	}
+}
+
+func TestGetClusterCIDRsGKE(t *testing.T) {
+	f, restore := fakeCluster("gke", "gke_my-project_us-central1-a_knative-e2e", "")
+	defer restore()
+	f.results = []fakeResult{{out: "10.8.0.0/14"}, {out: "10.12.0.0/20"}}
+
+	pod, service, err := GetClusterCIDRs()
+	if nil != err || "10.8.0.0/14" != pod || "10.12.0.0/20" != service {
+		t.Errorf("GetClusterCIDRs() = '%s', '%s', %v, want '10.8.0.0/14', '10.12.0.0/20'", pod, service, err)
+	}
+	got := f.commands()
+	if 2 != len(got) || !strings.HasSuffix(got[0], "--format=value(clusterIpv4Cidr)") || !strings.HasSuffix(got[1], "--format=value(servicesIpv4Cidr)") {
+		t.Errorf("Expected describing both CIDRs, got %v", got)
+	}
+}
+
+func TestGetClusterCIDRsGeneric(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		results     []fakeResult
+		wantPod     string
+		wantService string
+		wantErr     bool
+	}{{
+		name: "controller manager flags",
+		results: []fakeResult{{out: "kube-controller-manager --allocate-node-cidrs=true --cluster-cidr=10.244.0.0/16 " +
+			"--service-cluster-ip-range=10.96.0.0/12"}},
+		wantPod:     "10.244.0.0/16",
+		wantService: "10.96.0.0/12",
+	}, {
+		name:        "node pod CIDR",
+		results:     []fakeResult{{out: "kube-controller-manager --service-cluster-ip-range=10.96.0.0/12"}, {out: "10.244.0.0/24"}},
+		wantPod:     "10.244.0.0/24",
+		wantService: "10.96.0.0/12",
+	}, {
+		name:    "no controller manager",
+		results: []fakeResult{{out: ""}, {out: "10.244.0.0/24"}},
+		wantErr: true,
+	}} {
+		f, restore := fakeCluster("kind", "kind-knative", "")
+		f.results = tc.results
+		pod, service, err := GetClusterCIDRs()
+		restore()
+		if (nil != err) != tc.wantErr || tc.wantPod != pod || tc.wantService != service {
+			t.Errorf("%s: GetClusterCIDRs() = '%s', '%s', %v, want '%s', '%s' with error=%v",
+				tc.name, pod, service, err, tc.wantPod, tc.wantService, tc.wantErr)
+		}
+		if nil != err && !strings.Contains(err.Error(), "unsupported on provider 'kind'") {
+			t.Errorf("%s: expected an unsupported provider error, got %v", tc.name, err)
+		}
+	}
+}
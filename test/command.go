@@ -0,0 +1,212 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Command classes, each can have its own timeout, see timeoutFor.
+const (
+	kubectlClass = "kubectl"
+	gcloudClass  = "gcloud"
+	waitClass    = "wait"
+	httpClass    = "http" // requests of TestHTTPClient
+)
+
+// CommandRunner runs the named command with env appended to the current
+// environment, and returns its standard output. A command exiting with a
+// non-zero status is reported as a *CommandError.
+type CommandRunner func(ctx context.Context, env []string, name string, args ...string) ([]byte, error)
+
+// StreamRunner runs the named command, copying its standard output to w
+// until it exits or ctx is done.
+type StreamRunner func(ctx context.Context, w io.Writer, name string, args ...string) error
+
+// runner and streamer execute every external command issued by this package,
+// unit tests replace them with fakes.
+var (
+	runner   CommandRunner = execCommand
+	streamer StreamRunner  = execStream
+)
+
+// CommandError describes a command that failed to run or exited non-zero.
+type CommandError struct {
+	Command  string
+	ExitCode int // -1 if the command could not be started
+	Stderr   string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("error executing '%s' (exit code %d): '%s'", e.Command, e.ExitCode, e.Stderr)
+}
+
+// newCommandError wraps the error err of running a command, with its stderr
+// or the error itself when stderr is empty.
+func newCommandError(name string, args []string, err error, stderr string) *CommandError {
+	ce := &CommandError{Command: commandLine(name, args), ExitCode: -1, Stderr: strings.TrimSpace(stderr)}
+	if ee, ok := err.(*exec.ExitError); ok {
+		ce.ExitCode = ee.ExitCode()
+	}
+	if "" == ce.Stderr {
+		ce.Stderr = err.Error()
+	}
+	return ce
+}
+
+func execCommand(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if nil != err {
+		return out, newCommandError(name, args, err, stderr.String())
+	}
+	return out, nil
+}
+
+func execStream(ctx context.Context, w io.Writer, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); nil != err {
+		return newCommandError(name, args, err, stderr.String())
+	}
+	return nil
+}
+
+// exitCode returns the exit code carried by err, 0 for a nil error and -1 if
+// unknown.
+func exitCode(err error) int {
+	if nil == err {
+		return 0
+	}
+	if ce, ok := err.(*CommandError); ok {
+		return ce.ExitCode
+	}
+	return -1
+}
+
+func commandLine(name string, args []string) string {
+	return strings.TrimSpace(name + " " + strings.Join(args, " "))
+}
+
+// timeoutFor returns the timeout of the commands of class, set by the
+// -timeout.<class> flags and falling back to -cmdtimeout.
+func timeoutFor(class string) time.Duration {
+	var timeout time.Duration
+	switch class {
+	case kubectlClass:
+		timeout = Flags.KubectlTimeout
+	case gcloudClass:
+		timeout = Flags.GcloudTimeout
+	case waitClass:
+		timeout = Flags.WaitTimeout
+	case httpClass:
+		timeout = Flags.HTTPTimeout
+	}
+	if timeout > 0 {
+		return timeout
+	}
+	return Flags.CommandTimeout
+}
+
+// truncateOutput cuts output to max bytes for logging, max <= 0 means no limit.
+func truncateOutput(output string, max int) string {
+	if max <= 0 || len(output) <= max {
+		return output
+	}
+	// Back off to a rune boundary so that multi-byte characters aren't cut
+	cut := max
+	for cut > 0 && !utf8.RuneStart(output[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...[truncated %d bytes]", output[:cut], len(output)-cut)
+}
+
+// runCommand runs a command through the runner and returns its trimmed
+// standard output. The command class is its name.
+func runCommand(ctx context.Context, env []string, name string, args ...string) (string, error) {
+	return runClassCommand(ctx, name, env, name, args...)
+}
+
+// runClassCommand is runCommand bounded by the timeout of class.
+func runClassCommand(ctx context.Context, class string, env []string, name string, args ...string) (string, error) {
+	if timeout := timeoutFor(class); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if Flags.LogVerbose {
+		log.Printf("Running '%s'", commandLine(name, args))
+	}
+	start := time.Now()
+	out, err := runner(ctx, env, name, args...)
+	recordCommand(start, name, args, err)
+	output := strings.TrimSpace(string(out))
+	if Flags.LogVerbose {
+		log.Printf("Output of '%s': '%s' (error: %v)", commandLine(name, args), truncateOutput(output, Flags.MaxLogBytes), err)
+	}
+	return output, err
+}
+
+// kubectlArgs prepends the global kubectl flags derived from Flags to args.
+func kubectlArgs(args []string) []string {
+	if "" != Flags.Cluster {
+		args = append([]string{"--cluster", Flags.Cluster}, args...)
+	}
+	return args
+}
+
+// kubectlClassOf returns the command class of kubectl args: waiting
+// subcommands may legitimately take much longer than the other ones.
+func kubectlClassOf(args []string) string {
+	if len(args) > 0 && ("wait" == args[0] || "drain" == args[0]) {
+		return waitClass
+	}
+	if len(args) > 1 && "rollout" == args[0] && "status" == args[1] {
+		return waitClass
+	}
+	return kubectlClass
+}
+
+// kubectl runs kubectl against the cluster selected by -cluster.
+func kubectl(ctx context.Context, args ...string) (string, error) {
+	return runClassCommand(ctx, kubectlClassOf(args), nil, "kubectl", kubectlArgs(args)...)
+}
+
+// gcloud runs a gcloud command, with the configuration selected by -gcloudconfig.
+func gcloud(ctx context.Context, args ...string) (string, error) {
+	var env []string
+	if "" != Flags.GcloudConfig {
+		env = []string{"CLOUDSDK_ACTIVE_CONFIG_NAME=" + Flags.GcloudConfig}
+	}
+	return runCommand(ctx, env, "gcloud", args...)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCall records a command issued through the runner.
+type fakeCall struct {
+	env      []string
+	name     string
+	args     []string
+	deadline time.Time // zero if the context has no deadline
+}
+
+func (c fakeCall) String() string {
+	return commandLine(c.name, c.args)
+}
+
+// fakeResult is what the fake runner replies to a command.
+type fakeResult struct {
+	out string
+	err error
+}
+
+// fakeRunner replaces the command runner in unit tests. It replies to the
+// calls with results in order, repeating the last one when exhausted, or
+// delegates to handler when set.
+type fakeRunner struct {
+	mu      sync.Mutex
+	calls   []fakeCall
+	results []fakeResult
+	handler func(fakeCall) fakeResult
+}
+
+func (f *fakeRunner) run(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call := fakeCall{env: env, name: name, args: args}
+	call.deadline, _ = ctx.Deadline()
+	f.calls = append(f.calls, call)
+	var res fakeResult
+	switch {
+	case nil != f.handler:
+		res = f.handler(call)
+	case len(f.results) > 0:
+		res = f.results[0]
+		if len(f.results) > 1 {
+			f.results = f.results[1:]
+		}
+	}
+	return []byte(res.out), res.err
+}
+
+func (f *fakeRunner) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []string
+	for _, c := range f.calls {
+		res = append(res, c.String())
+	}
+	return res
+}
+
+// useFakeRunner installs a fake runner replying with results, and returns it
+// along with a function restoring the real runner.
+func useFakeRunner(results ...fakeResult) (*fakeRunner, func()) {
+	f := &fakeRunner{results: results}
+	saved := runner
+	runner = f.run
+	return f, func() { runner = saved }
+}
+
+// exitErr builds the error of a command exiting with code.
+func exitErr(code int, stderr string) error {
+	return &CommandError{Command: "fake", ExitCode: code, Stderr: stderr}
+}
+
+func TestKubectlUsesClusterFlag(t *testing.T) {
+	defer saveFlags()()
+	f, restore := useFakeRunner(fakeResult{out: " out \n"})
+	defer restore()
+
+	Flags.Cluster = "my-cluster"
+	out, err := kubectl(context.Background(), "get", "pods")
+	if nil != err || "out" != out {
+		t.Fatalf("Expected trimmed output 'out' and no error, got '%s', %v", out, err)
+	}
+	want := []string{"kubectl --cluster my-cluster get pods"}
+	if got := f.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got commands %v, want %v", got, want)
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	defer saveFlags()()
+	Flags.CommandTimeout = time.Millisecond
+	saved := runner
+	defer func() { runner = saved }()
+	runner = func(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if _, err := runCommand(context.Background(), nil, "sleep", "10"); context.DeadlineExceeded != err {
+		t.Errorf("Expected the command to time out, got %v", err)
+	}
+}
+
+func TestExecCommandError(t *testing.T) {
+	_, err := execCommand(context.Background(), nil, "sh", "-c", "echo boom >&2; exit 3")
+	if 3 != exitCode(err) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected exit code 3 with stderr, got %v", err)
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	defer saveFlags()()
+	Flags.CommandTimeout = time.Minute
+	Flags.KubectlTimeout = 10 * time.Second
+	Flags.GcloudTimeout = 0
+	Flags.WaitTimeout = 10 * time.Minute
+	Flags.HTTPTimeout = 0
+
+	for _, tc := range []struct {
+		class string
+		want  time.Duration
+	}{
+		{kubectlClass, 10 * time.Second},
+		{gcloudClass, time.Minute},
+		{waitClass, 10 * time.Minute},
+		{httpClass, time.Minute},
+		{"docker", time.Minute},
+	} {
+		if got := timeoutFor(tc.class); got != tc.want {
+			t.Errorf("timeoutFor(%q) = %v, want %v", tc.class, got, tc.want)
+		}
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		max    int
+		want   string
+	}{
+		{"short", 10, "short"},
+		{"exactly 10", 10, "exactly 10"},
+		{"this is too long", 7, "this is...[truncated 9 bytes]"},
+		{"no limit", 0, "no limit"},
+		{"héllo", 2, "h...[truncated 5 bytes]"},
+	} {
+		if got := truncateOutput(tc.output, tc.max); got != tc.want {
+			t.Errorf("truncateOutput(%q, %d) = '%s', want '%s'", tc.output, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestCommandClassDeadlines(t *testing.T) {
+	defer saveFlags()()
+	Flags.CommandTimeout = time.Minute
+	Flags.KubectlTimeout = 10 * time.Second
+	Flags.GcloudTimeout = 0
+	Flags.WaitTimeout = 10 * time.Minute
+	f, restore := useFakeRunner()
+	defer restore()
+
+	for _, tc := range []struct {
+		run  func(ctx context.Context) (string, error)
+		want time.Duration
+	}{
+		{func(ctx context.Context) (string, error) { return kubectl(ctx, "apply", "-f", "service.yaml") }, 10 * time.Second},
+		{func(ctx context.Context) (string, error) { return kubectl(ctx, "rollout", "status", "deploy/foo") }, 10 * time.Minute},
+		{func(ctx context.Context) (string, error) {
+			return kubectl(ctx, "wait", "pod/foo", "--for=condition=Ready")
+		}, 10 * time.Minute},
+		{func(ctx context.Context) (string, error) { return gcloud(ctx, "config", "list") }, time.Minute},
+	} {
+		start := time.Now()
+		tc.run(context.Background())
+		call := f.calls[len(f.calls)-1]
+		if got := call.deadline.Sub(start); got < tc.want-time.Second || got > tc.want+time.Second {
+			t.Errorf("'%s' got a deadline in %v, want %v", call, got, tc.want)
+		}
+	}
+}
+
+func TestRunCommandLogsTruncatedOutput(t *testing.T) {
+	defer saveFlags()()
+	Flags.LogVerbose = true
+	Flags.MaxLogBytes = 4
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	_, restore := useFakeRunner(fakeResult{out: "0123456789"})
+	defer restore()
+
+	out, err := runClassCommand(context.Background(), kubectlClass, nil, "kubectl", "get", "cm")
+	if nil != err || "0123456789" != out {
+		t.Errorf("Expected the full output to be returned, got '%s' (error: %v)", out, err)
+	}
+	if !strings.Contains(logs.String(), "'0123...[truncated 6 bytes]'") || strings.Contains(logs.String(), "456789") {
+		t.Errorf("Expected the logged output to be truncated, got '%s'", logs.String())
+	}
+}
+
+func TestGcloudConfig(t *testing.T) {
+	defer saveFlags()()
+	f, restore := useFakeRunner()
+	defer restore()
+
+	Flags.GcloudConfig = "work"
+	gcloud(context.Background(), "config", "list")
+	kubectl(context.Background(), "get", "pods")
+	Flags.GcloudConfig = ""
+	gcloud(context.Background(), "config", "list")
+
+	if want := []string{"CLOUDSDK_ACTIVE_CONFIG_NAME=work"}; !reflect.DeepEqual(f.calls[0].env, want) {
+		t.Errorf("Got gcloud env %v, want %v", f.calls[0].env, want)
+	}
+	if 0 != len(f.calls[1].env) || 0 != len(f.calls[2].env) {
+		t.Errorf("Expected no extra env for kubectl nor without -gcloudconfig, got %v and %v", f.calls[1].env, f.calls[2].env)
+	}
+}
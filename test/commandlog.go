@@ -0,0 +1,51 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// commandLogMu serializes the writes to -commandlog by concurrent tests.
+var commandLogMu sync.Mutex
+
+// recordCommand appends a line describing a command started at start and
+// failed with err, nil if it succeeded, to the -commandlog file if set.
+func recordCommand(start time.Time, name string, args []string, err error) {
+	if "" == Flags.CommandLog {
+		return
+	}
+	line := fmt.Sprintf("%s\t%s\texit=%d\t%s\n", start.UTC().Format(time.RFC3339Nano),
+		time.Since(start).Round(time.Millisecond), exitCode(err), commandLine(name, args))
+
+	commandLogMu.Lock()
+	defer commandLogMu.Unlock()
+	f, ferr := os.OpenFile(Flags.CommandLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if nil == ferr {
+		_, ferr = f.WriteString(line)
+		if cerr := f.Close(); nil == ferr {
+			ferr = cerr
+		}
+	}
+	if nil != ferr {
+		log.Printf("Failed recording command to %s: %v", Flags.CommandLog, ferr)
+	}
+}
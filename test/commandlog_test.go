@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommandLog(t *testing.T) {
+	defer saveFlags()()
+	dir, err := ioutil.TempDir("", "commandlog")
+	if nil != err {
+		t.Fatalf("Failed creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	Flags.CommandLog = filepath.Join(dir, "commands.log")
+	_, restore := useFakeRunner(fakeResult{}, fakeResult{err: exitErr(2, "boom")}, fakeResult{})
+	defer restore()
+
+	kubectl(context.Background(), "get", "pods")
+	gcloud(context.Background(), "config", "list")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			kubectl(context.Background(), "get", "svc")
+		}()
+	}
+	wg.Wait()
+
+	content, err := ioutil.ReadFile(Flags.CommandLog)
+	if nil != err {
+		t.Fatalf("Failed reading command log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if 12 != len(lines) {
+		t.Fatalf("Expected 12 entries, got %d: %v", len(lines), lines)
+	}
+	for i, want := range []struct {
+		exit    string
+		command string
+	}{
+		{"exit=0", "kubectl get pods"},
+		{"exit=2", "gcloud config list"},
+		{"exit=0", "kubectl get svc"},
+	} {
+		fields := strings.Split(lines[i], "\t")
+		if 4 != len(fields) {
+			t.Fatalf("Expected 4 fields in '%s'", lines[i])
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields[0]); nil != err {
+			t.Errorf("Invalid timestamp in '%s': %v", lines[i], err)
+		}
+		if _, err := time.ParseDuration(fields[1]); nil != err {
+			t.Errorf("Invalid duration in '%s': %v", lines[i], err)
+		}
+		if want.exit != fields[2] || want.command != fields[3] {
+			t.Errorf("Got entry '%s', want '%s' and '%s'", lines[i], want.exit, want.command)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envKey normalizes a flag name or an environment key so that, e.g.,
+// DOCKER_REPO matches -dockerrepo and TIMEOUT_KUBECTL matches -timeout.kubectl.
+func envKey(s string) string {
+	return strings.NewReplacer("_", "", ".", "", "-", "").Replace(strings.ToLower(s))
+}
+
+// LoadDotenv sets the flags from the KEY=VALUE lines of the dotenv file at
+// path, ignoring blank lines and # comments, unless they were explicitly set
+// on the command line. It must be called after the flags are parsed.
+func LoadDotenv(path string) error {
+	return loadDotenv(flag.CommandLine, path)
+}
+
+func loadDotenv(fs *flag.FlagSet, path string) error {
+	if "" == path {
+		return nil
+	}
+	f, err := os.Open(path)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	flags := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) { flags[envKey(f.Name)] = f.Name })
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if 2 != len(kv) {
+			return fmt.Errorf("%s:%d: malformed line, want KEY=VALUE", path, n)
+		}
+		name, ok := flags[envKey(strings.TrimSpace(kv[0]))]
+		if !ok {
+			return fmt.Errorf("%s:%d: no flag for key '%s'", path, n, kv[0])
+		}
+		if explicit[name] {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"'`)
+		if err = fs.Set(name, value); nil != err {
+			return fmt.Errorf("%s:%d: invalid value for -%s: %v", path, n, name, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadDotenv(t *testing.T) {
+	f, err := ioutil.TempFile("", "dotenv")
+	if nil != err {
+		t.Fatalf("Failed creating temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`# local settings
+DOCKER_REPO=gcr.io/my-project
+
+TAG="v1"
+LOGVERBOSE=true
+TIMEOUT_KUBECTL=30s
+`)
+	f.Close()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	repo := fs.String("dockerrepo", "", "")
+	tag := fs.String("tag", "latest", "")
+	verbose := fs.Bool("logverbose", false, "")
+	timeout := fs.Duration("timeout.kubectl", 0, "")
+	if err = fs.Parse([]string{"-tag", "v2"}); nil != err {
+		t.Fatalf("Failed parsing flags: %v", err)
+	}
+
+	if err = loadDotenv(fs, f.Name()); nil != err {
+		t.Fatalf("Failed loading dotenv: %v", err)
+	}
+	if "gcr.io/my-project" != *repo || !*verbose || 30*time.Second != *timeout {
+		t.Errorf("Expected the dotenv values, got dockerrepo=%s logverbose=%v timeout.kubectl=%v", *repo, *verbose, *timeout)
+	}
+	if "v2" != *tag {
+		t.Errorf("Expected the command line -tag to win, got '%s'", *tag)
+	}
+}
+
+func TestLoadDotenvErrors(t *testing.T) {
+	for _, content := range []string{"UNKNOWN_KEY=1\n", "TAG\n", "LOGVERBOSE=maybe\n"} {
+		f, err := ioutil.TempFile("", "dotenv")
+		if nil != err {
+			t.Fatalf("Failed creating temp file: %v", err)
+		}
+		f.WriteString(content)
+		f.Close()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("tag", "latest", "")
+		fs.Bool("logverbose", false, "")
+		if err = loadDotenv(fs, f.Name()); nil == err {
+			t.Errorf("Expected an error loading '%s', got nil", content)
+		}
+		os.Remove(f.Name())
+	}
+}
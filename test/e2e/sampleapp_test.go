@@ -19,6 +19,9 @@ limitations under the License.
 package e2etest
 
 import (
+	"flag"
+	"log"
+	"os"
 	"testing"
 
 	"github.com/knative/docs/test/sampleapp"
@@ -30,6 +33,28 @@ const (
 	configFile = "../sampleapp/config.yaml"
 )
 
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if err := test.LoadDotenv(test.Flags.EnvFile); nil != err {
+		log.Fatalf("Failed loading env file: %v", err)
+	}
+	if err := test.ApplyProfile(test.Flags.Profile); nil != err {
+		log.Fatalf("Failed applying profile: %v", err)
+	}
+	test.ApplyBranchTag()
+	if err := test.Flags.Validate(); nil != err {
+		log.Fatalf("Invalid flags: %v", err)
+	}
+	test.Flags.LogEnvironment()
+	stop, err := test.StartProfiling()
+	if nil != err {
+		log.Fatalf("Failed starting profiling: %v", err)
+	}
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
 // TestSampleApp runs all sample apps from different languages
 func TestSampleApp(t *testing.T) {
 	lcs, err := sampleapp.GetConfigs(configFile)
@@ -182,7 +182,10 @@ func checkDeployment(t *testing.T, appName, expectedOutput string) {
 // SampleAppTestBase tests individual sample app
 func SampleAppTestBase(t *testing.T, lc sampleapp.LanguageConfig, expectedOutput string) {
 	t.Parallel()
-	imagePath := test.ImagePath(lc.AppName)
+	imagePath, err := test.ResolveImagePath(lc.AppName, lc.Language)
+	if nil != err {
+		t.Fatalf("Failed resolving image of %s: %v", lc.AppName, err)
+	}
 	yamlFilePath := path.Join(lc.WorkDir, "service.yaml")
 
 	CleanupOnInterrupt(func() { cleanup(yamlFilePath, lc.WorkDir) })
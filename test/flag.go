@@ -17,10 +17,15 @@ limitations under the License.
 package test
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Flags holds the command line flags or defaults for settings in the user's environment.
@@ -35,6 +40,44 @@ type EnvironmentFlags struct {
 	EmitMetrics bool   // Emit metrics
 	Tag         string // Docker image tag
 	Languages   string // Whitelisted languages to run
+
+	SkipOnUnmetPrereqs   bool          // Skip instead of fail when cluster prerequisites are unmet
+	CommandTimeout       time.Duration // Timeout of every external command run by the helpers
+	KubectlTimeout       time.Duration // Timeout of kubectl commands, defaults to CommandTimeout
+	GcloudTimeout        time.Duration // Timeout of gcloud commands, defaults to CommandTimeout
+	WaitTimeout          time.Duration // Timeout of waiting commands, defaults to CommandTimeout
+	Provider             string        // Cloud provider hosting the cluster
+	GSA                  string        // Google service account bound to KSAs for Workload Identity
+	ImageTool            string        // Tool used to inspect and manipulate images: docker or crane
+	ForbidLatestTag      bool          // Reject the `latest` tag for reproducibility
+	IngressNamespace     string        // Namespace of the ingress controller Service
+	IngressService       string        // Name of the ingress controller Service
+	MaxLogBytes          int           // Maximum number of bytes of command output logged
+	SSAForce             bool          // Force conflicts of server-side apply
+	CommandLog           string        // File recording every command run by the helpers
+	ImageReplacements    string        // Comma separated from=to rewrites of image references
+	GcloudConfig         string        // Named gcloud configuration used by gcloud commands
+	CPUProfile           string        // File to write a CPU profile of the test binary to
+	MemProfile           string        // File to write a heap profile of the test binary to
+	TagTemplate          string        // Template of the image tag, overriding Tag
+	DebugImage           string        // Default image of debug pods
+	BestEffortResolution bool          // Resolve cluster properties to empty values instead of failing
+	ImageNameStrategy    string        // How ImageForPath names images: basename or full
+	Profile              string        // Named set of flag defaults, see RegisterProfile
+	EnvFile              string        // Dotenv file holding flag values, see LoadDotenv
+	LanguageRepos        string        // Comma separated lang=repo Docker repos overriding DockerRepo
+	InjectSidecarImage   string        // Name of the image of a sidecar injected by InjectContainers
+	InjectInitImage      string        // Name of the image of an init container injected by InjectContainers
+	NamespaceLabels      string        // Comma separated key=value labels of the namespaces created by the tests
+	HTTPTimeout          time.Duration // Timeout of the requests of TestHTTPClient, defaults to CommandTimeout
+	InsecureSkipTLS      bool          // Whether TestHTTPClient skips verifying the certificates of servers
+	UseBranchTag         bool          // Whether the images are tagged with the current git branch, see ApplyBranchTag
+	Owner                string        // Owner of the tests to run, see ShouldRunForOwner
+	CosignKey            string        // Public key VerifyImageSignature verifies signatures with
+	CosignOIDCIssuer     string        // OIDC issuer of the keyless signatures VerifyImageSignature accepts
+	RegistryCredsFile    string        // JSON file of the credentials of the registry of DockerRepo, see LoadRegistryCreds
+	ApplyStrategy        string        // How ApplyOrdered applies manifests: client or server side
+	TraceFile            string        // File the Tracer writes the timings of the test phases to
 }
 
 func initializeFlags() *EnvironmentFlags {
@@ -55,12 +98,276 @@ func initializeFlags() *EnvironmentFlags {
 
 	flag.StringVar(&f.Languages, "languages", "", "Comma separated languages to run e2e test on.")
 
+	flag.BoolVar(&f.SkipOnUnmetPrereqs, "skiponunmet", false,
+		"Set this flag to true to skip tests, rather than fail them, when cluster prerequisites are not met.")
+
+	flag.DurationVar(&f.CommandTimeout, "cmdtimeout", time.Minute,
+		"Provide the timeout of each external command (kubectl, gcloud, docker...) run by the test helpers.")
+
+	flag.DurationVar(&f.KubectlTimeout, "timeout.kubectl", 0,
+		"Provide the timeout of kubectl commands. Defaults to -cmdtimeout.")
+
+	flag.DurationVar(&f.GcloudTimeout, "timeout.gcloud", 0,
+		"Provide the timeout of gcloud commands. Defaults to -cmdtimeout.")
+
+	flag.DurationVar(&f.WaitTimeout, "timeout.wait", 0,
+		"Provide the timeout of commands waiting for a condition, e.g. `kubectl rollout status`. Defaults to -cmdtimeout.")
+
+	flag.StringVar(&f.Provider, "provider", "gke", "Provide the cloud provider hosting the cluster.")
+
+	flag.StringVar(&f.GSA, "gsa", "",
+		"Provide the email of the Google service account used by Workload Identity tests.")
+
+	flag.StringVar(&f.ImageTool, "imagetool", "docker",
+		"Provide the tool used to inspect and manipulate images, either `docker` or `crane`.")
+
+	flag.BoolVar(&f.ForbidLatestTag, "forbidlatest", false,
+		"Set this flag to true to reject the `latest` image tag, so that runs are reproducible.")
+
+	flag.StringVar(&f.IngressNamespace, "ingressnamespace", "istio-system",
+		"Provide the namespace of the ingress controller Service.")
+
+	flag.StringVar(&f.IngressService, "ingressservice", "istio-ingressgateway",
+		"Provide the name of the ingress controller Service.")
+
+	flag.IntVar(&f.MaxLogBytes, "maxlogbytes", 4096,
+		"Provide the maximum number of bytes of command output logged with -logverbose, 0 for no limit.")
+
+	flag.BoolVar(&f.SSAForce, "ssaforce", false,
+		"Set this flag to true to take ownership of conflicting fields on server-side apply.")
+
+	flag.StringVar(&f.CommandLog, "commandlog", "",
+		"Provide a file to append a line to for every command run by the test helpers, for auditing.")
+
+	flag.StringVar(&f.ImageReplacements, "imagereplacements", "",
+		"Provide comma separated from=to pairs rewriting image references starting with `from`, e.g. for mirrored registries.")
+
+	flag.StringVar(&f.GcloudConfig, "gcloudconfig", "",
+		"Provide the named gcloud configuration to use. Defaults to the active configuration.")
+
+	// go test takes -cpuprofile and -memprofile for itself, passing them to the
+	// test binary as -test.cpuprofile and -test.memprofile
+	flag.StringVar(&f.CPUProfile, "harnesscpuprofile", "",
+		"Provide a file to write a CPU profile of the test binary to, see StartProfiling.")
+
+	flag.StringVar(&f.MemProfile, "harnessmemprofile", "",
+		"Provide a file to write a heap profile of the test binary to, see StartProfiling.")
+
+	flag.StringVar(&f.TagTemplate, "tagtemplate", "",
+		"Provide a template of the image tag, overriding -tag, using the {lang}, {sha}, {runid} and {date} placeholders.")
+
+	flag.StringVar(&f.DebugImage, "debugimage", "curlimages/curl",
+		"Provide the default image of the one-off pods run for diagnostics.")
+
+	flag.BoolVar(&f.BestEffortResolution, "besteffort", false,
+		"Set this flag to true to resolve cluster properties (name, region...) to empty values with a warning instead of failing.")
+
+	flag.StringVar(&f.ImageNameStrategy, "imagenamestrategy", basenameStrategy,
+		"Provide how images are named after the path of their component, `basename` (cmd/foo/bar gives foo-bar) or `full` (cmd-foo-bar).")
+
+	flag.StringVar(&f.Profile, "profile", "",
+		"Provide the name of the profile, e.g. `nightly`, whose flag defaults to apply, see RegisterProfile.")
+
+	flag.StringVar(&f.EnvFile, "envfile", "",
+		"Provide a dotenv file of KEY=VALUE lines setting the flags not passed on the command line, e.g. DOCKER_REPO=gcr.io/foo.")
+
+	flag.StringVar(&f.LanguageRepos, "languagerepos", "",
+		"Provide comma separated lang=repo pairs of Docker repos for the images of a language, overriding -dockerrepo.")
+
+	flag.StringVar(&f.InjectSidecarImage, "injectsidecarimage", "",
+		"Provide the name of an image, resolved like the sample images, to run as a sidecar of the test deployments.")
+
+	flag.StringVar(&f.InjectInitImage, "injectinitimage", "",
+		"Provide the name of an image, resolved like the sample images, to run as an init container of the test deployments.")
+
+	flag.StringVar(&f.NamespaceLabels, "namespacelabels", "",
+		"Provide comma separated key=value labels to set on every namespace used by the tests, e.g. pod-security.kubernetes.io/enforce=baseline.")
+
+	flag.DurationVar(&f.HTTPTimeout, "timeout.http", 0,
+		"Provide the timeout of the HTTP requests sent by the tests to the samples. Defaults to -cmdtimeout.")
+
+	flag.BoolVar(&f.InsecureSkipTLS, "insecureskiptls", false,
+		"Set this flag to true to not verify the TLS certificates of the samples, e.g. behind an ingress with a self-signed certificate.")
+
+	flag.BoolVar(&f.UseBranchTag, "usebranchtag", false,
+		"Set this flag to true to tag the test images with the current git branch, unless -tag is set, e.g. for preview builds.")
+
+	flag.StringVar(&f.Owner, "owner", "", "Provide the owner of the tests to run, e.g. a team. Runs the tests of every owner if empty.")
+
+	flag.StringVar(&f.CosignKey, "cosignkey", "",
+		"Provide the public key, as a path or KMS URI, to verify the signatures of the test images with.")
+
+	flag.StringVar(&f.CosignOIDCIssuer, "cosignoidc", "",
+		"Provide the OIDC issuer of keyless signatures of the test images to verify, e.g. https://accounts.google.com.")
+
+	flag.StringVar(&f.RegistryCredsFile, "registrycredsfile", "",
+		"Provide a docker config.json, or a {\"username\": ..., \"password\": ...} JSON file, holding the credentials of the registry of -dockerrepo. Uses the ambient credentials if empty.")
+
+	flag.StringVar(&f.ApplyStrategy, "applystrategy", clientSideApply,
+		"Provide how the test manifests are applied, either 'client' or 'server' side. Server-side apply honors -ssaforce.")
+
+	flag.StringVar(&f.TraceFile, "tracefile", "",
+		"Provide a file to write the timings of the test phases to, in the Chrome trace format viewable in chrome://tracing.")
+
 	return &f
 }
 
-// ImagePath is a helper function to prefix image name with repo and suffix with tag
+// Validate returns an error if the flags are inconsistent or violate a policy
+// they enable.
+func (f *EnvironmentFlags) Validate() error {
+	if dockerTool != f.ImageTool && craneTool != f.ImageTool {
+		return fmt.Errorf("-imagetool must be either '%s' or '%s', got '%s'", dockerTool, craneTool, f.ImageTool)
+	}
+	if basenameStrategy != f.ImageNameStrategy && fullStrategy != f.ImageNameStrategy {
+		return fmt.Errorf("-imagenamestrategy must be either '%s' or '%s', got '%s'", basenameStrategy, fullStrategy, f.ImageNameStrategy)
+	}
+	if clientSideApply != f.ApplyStrategy && serverSideApply != f.ApplyStrategy {
+		return fmt.Errorf("-applystrategy must be either '%s' or '%s', got '%s'", clientSideApply, serverSideApply, f.ApplyStrategy)
+	}
+	if _, err := parsePairs(f.ImageReplacements); nil != err {
+		return fmt.Errorf("invalid -imagereplacements: %v", err)
+	}
+	if _, err := parsePairs(f.LanguageRepos); nil != err {
+		return fmt.Errorf("invalid -languagerepos: %v", err)
+	}
+	if _, err := parsePairs(f.NamespaceLabels); nil != err {
+		return fmt.Errorf("invalid -namespacelabels: %v", err)
+	}
+	if "" != f.CosignKey && "" != f.CosignOIDCIssuer {
+		return errors.New("-cosignkey and -cosignoidc are mutually exclusive")
+	}
+	for flagName, image := range map[string]string{"injectsidecarimage": f.InjectSidecarImage, "injectinitimage": f.InjectInitImage} {
+		if "" != image && !validImageName.MatchString(image) {
+			return fmt.Errorf("-%s must be a valid image name, got '%s'", flagName, image)
+		}
+	}
+	return f.checkImageTags()
+}
+
+// AsMap returns the value of every field of the flags, keyed by field name.
+func (f *EnvironmentFlags) AsMap() map[string]string {
+	m := make(map[string]string)
+	v := reflect.ValueOf(f).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if field := v.Type().Field(i); "" == field.PkgPath { // exported
+			m[field.Name] = fmt.Sprint(v.Field(i).Interface())
+		}
+	}
+	return m
+}
+
+// LogEnvironment logs the value of every field of the flags, sorted by field
+// name, so that the log of a run records the environment it ran in.
+func (f *EnvironmentFlags) LogEnvironment() {
+	m := f.AsMap()
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Printf("Flag %s: %s", name, m[name])
+	}
+}
+
+// Clone returns a copy of the flags.
+func (f *EnvironmentFlags) Clone() *EnvironmentFlags {
+	c := *f
+	return &c
+}
+
+// DiffFlags returns a "Field: a -> b" line for every exported field having a
+// different value in a and b, in the order of the fields.
+func DiffFlags(a, b *EnvironmentFlags) []string {
+	var diff []string
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		field := va.Type().Field(i)
+		if "" != field.PkgPath { // unexported
+			continue
+		}
+		if x, y := va.Field(i).Interface(), vb.Field(i).Interface(); !reflect.DeepEqual(x, y) {
+			diff = append(diff, fmt.Sprintf("%s: %v -> %v", field.Name, x, y))
+		}
+	}
+	return diff
+}
+
+// parsePairs parses comma separated key=value pairs.
+func parsePairs(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	if "" == s {
+		return pairs, nil
+	}
+	for _, p := range strings.Split(s, ",") {
+		kv := strings.SplitN(p, "=", 2)
+		if 2 != len(kv) || "" == kv[0] || "" == kv[1] {
+			return nil, fmt.Errorf("malformed pair '%s', want key=value", p)
+		}
+		pairs[kv[0]] = kv[1]
+	}
+	return pairs, nil
+}
+
+// checkTag returns an error if tag is forbidden by -forbidlatest.
+func (f *EnvironmentFlags) checkTag(tag string) error {
+	if f.ForbidLatestTag && "latest" == tag {
+		return errors.New("the 'latest' tag is forbidden by -forbidlatest, provide a specific -tag")
+	}
+	return nil
+}
+
+// ImagePath is a helper function to prefix image name with repo and suffix with tag,
+// rewritten by -imagereplacements
 func ImagePath(name string) string {
-	return fmt.Sprintf("%s/%s:%s", Flags.DockerRepo, name, Flags.Tag)
+	return imageRef(name, "", mustImageTag(""))
+}
+
+// ImagePathForLanguage is ImagePath for an image of language, in the Docker
+// repo of the language set by -languagerepos if any, and tagged with the
+// language rendered in -tagtemplate.
+func ImagePathForLanguage(name, language string) string {
+	return imageRef(name, language, mustImageTag(language))
+}
+
+// imageRef returns the reference of the image name of language tagged tag.
+func imageRef(name, language, tag string) string {
+	repo := Flags.DockerRepo
+	repos, _ := parsePairs(Flags.LanguageRepos) // malformed pairs are reported by Validate
+	if r, ok := repos[language]; ok {
+		repo = r
+	}
+	return replaceImage(fmt.Sprintf("%s/%s:%s", repo, name, tag))
+}
+
+// replaceImage rewrites the image reference ref with the -imagereplacements
+// pair of longest matching prefix, if any.
+func replaceImage(ref string) string {
+	replacements, _ := parsePairs(Flags.ImageReplacements) // malformed pairs are reported by Validate
+	from := ""
+	for prefix := range replacements {
+		if strings.HasPrefix(ref, prefix) && len(prefix) > len(from) {
+			from = prefix
+		}
+	}
+	if "" == from {
+		return ref
+	}
+	return replacements[from] + strings.TrimPrefix(ref, from)
+}
+
+// ResolveImagePath is ImagePathForLanguage returning an error if the tag
+// template can't be rendered or the resolved tag is forbidden by -forbidlatest.
+// The language is empty for images not specific to a language.
+func ResolveImagePath(name, language string) (string, error) {
+	tag, err := Flags.imageTag(language)
+	if nil == err {
+		err = Flags.checkTag(tag)
+	}
+	if nil != err {
+		return "", fmt.Errorf("invalid image '%s': %v", name, err)
+	}
+	return imageRef(name, language, tag), nil
 }
 
 // GetWhitelistedLanguages is a helper function to return a map of whitelisted languages based on Languages filter
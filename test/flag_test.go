@@ -0,0 +1,207 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// saveFlags snapshots the global Flags and returns a function restoring them,
+// so tests can freely mutate Flags with `defer saveFlags()()`.
+func saveFlags() func() {
+	saved := *Flags
+	return func() { *Flags = saved }
+}
+
+func TestValidateForbidLatest(t *testing.T) {
+	defer saveFlags()()
+	for _, tc := range []struct {
+		forbid  bool
+		tag     string
+		wantErr bool
+	}{
+		{false, "latest", false},
+		{true, "latest", true},
+		{true, "v0.9.0", false},
+	} {
+		Flags.ForbidLatestTag = tc.forbid
+		Flags.Tag = tc.tag
+		if err := Flags.Validate(); (nil != err) != tc.wantErr {
+			t.Errorf("Validate() with -forbidlatest=%v -tag=%s: got error %v, want error=%v", tc.forbid, tc.tag, err, tc.wantErr)
+		}
+		if _, err := ResolveImagePath("helloworld-go", "go"); (nil != err) != tc.wantErr {
+			t.Errorf("ResolveImagePath() with -forbidlatest=%v -tag=%s: got error %v, want error=%v", tc.forbid, tc.tag, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateImageTool(t *testing.T) {
+	defer saveFlags()()
+	Flags.ImageTool = "podman"
+	if err := Flags.Validate(); nil == err {
+		t.Error("Expected an error for an unsupported -imagetool, got nil")
+	}
+}
+
+func TestImagePathReplacements(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+	Flags.ImageReplacements = "gcr.io/knative-samples=mirror.local/samples," +
+		"gcr.io/knative-samples/helloworld-go:v1=mirror.local/hello:go"
+
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"helloworld-go", "mirror.local/hello:go"},
+		{"helloworld-java", "mirror.local/samples/helloworld-java:v1"},
+	} {
+		if got := ImagePath(tc.name); tc.want != got {
+			t.Errorf("ImagePath(%q) = '%s', want '%s'", tc.name, got, tc.want)
+		}
+	}
+
+	Flags.ImageReplacements = "docker.io/other=mirror.local/other"
+	if got, want := ImagePath("helloworld-go"), "gcr.io/knative-samples/helloworld-go:v1"; want != got {
+		t.Errorf("ImagePath() = '%s', want '%s'", got, want)
+	}
+}
+
+func TestValidateImageReplacements(t *testing.T) {
+	defer saveFlags()()
+	Flags.ImageReplacements = "gcr.io/a=gcr.io/b,gcr.io/c"
+	if err := Flags.Validate(); nil == err {
+		t.Error("Expected an error for a malformed -imagereplacements, got nil")
+	}
+}
+
+func TestAsMap(t *testing.T) {
+	defer saveFlags()()
+	Flags.Tag = "v1"
+	Flags.LogVerbose = true
+	Flags.CommandTimeout = 90 * time.Second
+
+	m := Flags.AsMap()
+	typ := reflect.TypeOf(*Flags)
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := m[typ.Field(i).Name]; !ok {
+			t.Errorf("Field %s is missing from AsMap()", typ.Field(i).Name)
+		}
+	}
+	if typ.NumField() != len(m) {
+		t.Errorf("Expected %d fields in AsMap(), got %d", typ.NumField(), len(m))
+	}
+	for k, want := range map[string]string{"Tag": "v1", "LogVerbose": "true", "CommandTimeout": "1m30s"} {
+		if got := m[k]; want != got {
+			t.Errorf("AsMap()[%q] = '%s', want '%s'", k, got, want)
+		}
+	}
+}
+
+func TestImagePathForLanguage(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+	Flags.LanguageRepos = "java=gcr.io/java-samples,go=gcr.io/go-samples"
+
+	for _, tc := range []struct {
+		language string
+		want     string
+	}{
+		{"go", "gcr.io/go-samples/helloworld:v1"},
+		{"python", "gcr.io/knative-samples/helloworld:v1"},
+	} {
+		if got := ImagePathForLanguage("helloworld", tc.language); tc.want != got {
+			t.Errorf("ImagePathForLanguage(%q) = '%s', want '%s'", tc.language, got, tc.want)
+		}
+	}
+
+	Flags.LanguageRepos = "java=gcr.io/java-samples,go"
+	if err := Flags.Validate(); nil == err {
+		t.Error("Expected an error for a malformed -languagerepos, got nil")
+	}
+}
+
+func TestDiffFlags(t *testing.T) {
+	a := &EnvironmentFlags{Cluster: "knative-e2e", Tag: "v1", LogVerbose: true, CommandTimeout: time.Minute}
+	b := a.Clone()
+	if diff := DiffFlags(a, b); 0 != len(diff) {
+		t.Errorf("Expected no difference between clones, got %v", diff)
+	}
+	b.Tag = "v2"
+	b.LogVerbose = false
+	b.CommandTimeout = 2 * time.Minute
+	want := []string{"Tag: v1 -> v2", "LogVerbose: true -> false", "CommandTimeout: 1m0s -> 2m0s"}
+	sort.Strings(want)
+	got := DiffFlags(a, b)
+	sort.Strings(got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("DiffFlags() = %v, want %v", got, want)
+	}
+	if "knative-e2e" != a.Cluster || "v1" != a.Tag {
+		t.Errorf("Expected changing the clone to leave the original alone, got %+v", a)
+	}
+}
+
+func TestDiffFlagsCoversEveryField(t *testing.T) {
+	a, b := &EnvironmentFlags{}, &EnvironmentFlags{}
+	vb := reflect.ValueOf(b).Elem()
+	for i := 0; i < vb.NumField(); i++ {
+		switch field := vb.Field(i); field.Kind() {
+		case reflect.String:
+			field.SetString("x")
+		case reflect.Bool:
+			field.SetBool(true)
+		case reflect.Int, reflect.Int64:
+			field.SetInt(1)
+		default:
+			t.Fatalf("Unhandled kind %v of field %s", field.Kind(), vb.Type().Field(i).Name)
+		}
+	}
+	if got, want := len(DiffFlags(a, b)), vb.NumField(); want != got {
+		t.Errorf("Got %d differing fields, want all %d", got, want)
+	}
+}
+
+func TestLogEnvironment(t *testing.T) {
+	defer saveFlags()()
+	Flags.Cluster = "knative-e2e"
+	Flags.Tag = "v1"
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	Flags.LogEnvironment()
+	got := logs.String()
+	if !strings.Contains(got, "Flag Cluster: knative-e2e\n") || !strings.Contains(got, "Flag Tag: v1\n") {
+		t.Errorf("Expected the flags in the logs, got '%s'", got)
+	}
+	if n, want := strings.Count(got, "\n"), len(Flags.AsMap()); want != n {
+		t.Errorf("Got %d logged flags, want %d", n, want)
+	}
+	if strings.Index(got, "Flag Cluster:") > strings.Index(got, "Flag Tag:") {
+		t.Errorf("Expected the flags sorted by name, got '%s'", got)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"flag"
+	"fmt"
+)
+
+// profiles holds the flag overrides of each registered profile.
+var profiles = map[string]map[string]string{}
+
+// RegisterProfile registers the profile name, e.g. "nightly", overriding the
+// default values of flags by flag name, e.g. {"tag": "nightly"}.
+func RegisterProfile(name string, overrides map[string]string) {
+	profiles[name] = overrides
+}
+
+// ApplyProfile applies the overrides of the registered profile name to the
+// flags not explicitly set on the command line. It must be called after the
+// flags are parsed, an empty name is a no-op.
+func ApplyProfile(name string) error {
+	return applyProfile(flag.CommandLine, name)
+}
+
+func applyProfile(fs *flag.FlagSet, name string) error {
+	if "" == name {
+		return nil
+	}
+	overrides, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile '%s'", name)
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for k, v := range overrides {
+		if explicit[k] {
+			continue
+		}
+		if err := fs.Set(k, v); nil != err {
+			return fmt.Errorf("invalid override of -%s in profile '%s': %v", k, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestApplyProfile(t *testing.T) {
+	saved := profiles
+	defer func() { profiles = saved }()
+	RegisterProfile("pr", map[string]string{"tag": "pr", "logverbose": "true"})
+	RegisterProfile("nightly", map[string]string{"tag": "nightly", "cluster": "nightly-cluster"})
+
+	newFlagSet := func(args ...string) (*flag.FlagSet, *string, *string, *bool) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		tag := fs.String("tag", "latest", "")
+		cluster := fs.String("cluster", "", "")
+		verbose := fs.Bool("logverbose", false, "")
+		if err := fs.Parse(args); nil != err {
+			t.Fatalf("Failed parsing flags: %v", err)
+		}
+		return fs, tag, cluster, verbose
+	}
+
+	fs, tag, cluster, verbose := newFlagSet()
+	if err := applyProfile(fs, "pr"); nil != err || "pr" != *tag || !*verbose || "" != *cluster {
+		t.Errorf("Expected the pr profile to apply, got tag=%s verbose=%v cluster=%s (error: %v)", *tag, *verbose, *cluster, err)
+	}
+
+	fs, tag, cluster, _ = newFlagSet("-tag", "v1")
+	if err := applyProfile(fs, "nightly"); nil != err || "v1" != *tag || "nightly-cluster" != *cluster {
+		t.Errorf("Expected the explicit -tag to win, got tag=%s cluster=%s (error: %v)", *tag, *cluster, err)
+	}
+
+	fs, _, _, _ = newFlagSet()
+	if err := applyProfile(fs, "release"); nil == err {
+		t.Error("Expected an error for an unknown profile, got nil")
+	}
+	if err := applyProfile(fs, ""); nil != err {
+		t.Errorf("Expected no profile to be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const gkeProvider = "gke"
+
+// errUnsupportedProvider is returned by helpers only available on some providers.
+func errUnsupportedProvider(feature string) error {
+	return fmt.Errorf("%s is not supported on provider '%s'", feature, Flags.Provider)
+}
+
+// BindWorkloadIdentity makes the Kubernetes service account ksa act as the
+// Google service account set by -gsa: the KSA is created if needed and
+// annotated, and the GSA is granted the workloadIdentityUser role for it in
+// the workload identity pool of the cluster project.
+func BindWorkloadIdentity(ctx context.Context, namespace, ksa string) error {
+	if gkeProvider != Flags.Provider {
+		return errUnsupportedProvider("Workload Identity")
+	}
+	if "" == Flags.GSA {
+		return fmt.Errorf("-gsa must be set to bind Workload Identity")
+	}
+	if !strings.Contains(Flags.GSA, "@") {
+		return fmt.Errorf("invalid Google service account '%s'", Flags.GSA)
+	}
+	// The workload identity pool belongs to the cluster project, which may
+	// differ from the project of the GSA
+	project, err := clusterProject()
+	if nil != err {
+		return err
+	}
+
+	if _, err := kubectl(ctx, "create", "serviceaccount", ksa, "-n", namespace); nil != err &&
+		!strings.Contains(err.Error(), "AlreadyExists") {
+		return err
+	}
+	if _, err := kubectl(ctx, "annotate", "serviceaccount", ksa, "-n", namespace, "--overwrite",
+		"iam.gke.io/gcp-service-account="+Flags.GSA); nil != err {
+		return err
+	}
+	_, err = gcloud(ctx, "iam", "service-accounts", "add-iam-policy-binding", Flags.GSA,
+		"--role", "roles/iam.workloadIdentityUser",
+		"--member", fmt.Sprintf("serviceAccount:%s.svc.id.goog[%s/%s]", project, namespace, ksa))
+	return err
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBindWorkloadIdentity(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		gsa  string
+	}{
+		{"same project", "tester@my-project.iam.gserviceaccount.com"},
+		{"cross project", "tester@other-project.iam.gserviceaccount.com"},
+		{"default compute", "1234-compute@developer.gserviceaccount.com"},
+	} {
+		f, restore := fakeCluster("gke", "gke_my-project_us-central1_knative-e2e", "")
+		Flags.GSA = tc.gsa
+		f.results = []fakeResult{{err: exitErr(1, `Error from server (AlreadyExists): serviceaccounts "ksa" already exists`)}, {}}
+		err := BindWorkloadIdentity(context.Background(), "ns", "ksa")
+		restore()
+		if nil != err {
+			t.Fatalf("%s: failed binding Workload Identity: %v", tc.name, err)
+		}
+		want := []string{
+			"kubectl --cluster gke_my-project_us-central1_knative-e2e create serviceaccount ksa -n ns",
+			"kubectl --cluster gke_my-project_us-central1_knative-e2e annotate serviceaccount ksa -n ns --overwrite iam.gke.io/gcp-service-account=" + tc.gsa,
+			"gcloud iam service-accounts add-iam-policy-binding " + tc.gsa + " " +
+				"--role roles/iam.workloadIdentityUser --member serviceAccount:my-project.svc.id.goog[ns/ksa]",
+		}
+		if got := f.commands(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got commands %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestBindWorkloadIdentityUnsupported(t *testing.T) {
+	defer saveFlags()()
+	Flags.Provider = "eks"
+	Flags.GSA = "tester@my-project.iam.gserviceaccount.com"
+	f, restore := useFakeRunner()
+	defer restore()
+
+	if err := BindWorkloadIdentity(context.Background(), "ns", "ksa"); nil == err {
+		t.Error("Expected an unsupported provider error, got nil")
+	}
+	if 0 != len(f.calls) {
+		t.Errorf("Expected no command, got %v", f.commands())
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	httpClientMu sync.Mutex
+	httpClient   *http.Client
+)
+
+// TestHTTPClient returns the client the tests should send their requests to
+// the samples with. Its requests time out after -timeout.http, it skips
+// verifying certificates with -insecureskiptls, and it's shared by the whole
+// run so that connections are reused.
+func TestHTTPClient() *http.Client {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	if nil == httpClient {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: Flags.InsecureSkipTLS}
+		httpClient = &http.Client{Timeout: timeoutFor(httpClass), Transport: transport}
+	}
+	return httpClient
+}
+
+// WaitForHTTPStatus sends GET requests to url with TestHTTPClient every
+// interval until it responds with wantStatus, or ctx is done. Failed requests
+// and other statuses are retried. The caller must close the body of the
+// returned response.
+func WaitForHTTPStatus(ctx context.Context, url string, wantStatus int, interval time.Duration) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if nil != err {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	var resp *http.Response
+	var last string
+	err = pollUntil(ctx, interval, func() (bool, error) {
+		r, err := TestHTTPClient().Do(req)
+		if nil != err {
+			// Keep the last response rather than the request cancelled by ctx
+			if nil == ctx.Err() {
+				last = err.Error()
+			}
+			return false, nil
+		}
+		if wantStatus != r.StatusCode {
+			last = r.Status
+			r.Body.Close()
+			return false, nil
+		}
+		resp = r
+		return true, nil
+	})
+	if nil != err {
+		return nil, fmt.Errorf("'%s' did not respond with status %d: %v (last response: %s)", url, wantStatus, err, last)
+	}
+	return resp, nil
+}
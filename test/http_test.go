@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetHTTPClient makes TestHTTPClient build a new client from the flags.
+func resetHTTPClient() {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	httpClient = nil
+}
+
+func TestTestHTTPClient(t *testing.T) {
+	defer saveFlags()()
+	defer resetHTTPClient()
+	for _, tc := range []struct {
+		timeout  time.Duration
+		insecure bool
+		want     time.Duration
+	}{
+		{0, false, time.Minute},
+		{10 * time.Second, true, 10 * time.Second},
+	} {
+		resetHTTPClient()
+		Flags.CommandTimeout = time.Minute
+		Flags.HTTPTimeout = tc.timeout
+		Flags.InsecureSkipTLS = tc.insecure
+		client := TestHTTPClient()
+		if tc.want != client.Timeout {
+			t.Errorf("-timeout.http=%v: got timeout %v, want %v", tc.timeout, client.Timeout, tc.want)
+		}
+		if got := client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify; tc.insecure != got {
+			t.Errorf("-insecureskiptls=%v: got InsecureSkipVerify=%v", tc.insecure, got)
+		}
+		if client != TestHTTPClient() {
+			t.Error("Expected the client to be reused")
+		}
+	}
+}
+
+func TestWaitForHTTPStatus(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 3 {
+			http.Error(w, "no healthy upstream", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("Hello Go Sample v1!"))
+	}))
+	defer server.Close()
+
+	resp, err := WaitForHTTPStatus(context.Background(), server.URL, http.StatusOK, time.Millisecond)
+	if nil != err {
+		t.Fatalf("Expected a 200 response, got %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if "Hello Go Sample v1!" != string(body) || 4 != atomic.LoadInt32(&requests) {
+		t.Errorf("Got body '%s' after %d requests, want 'Hello Go Sample v1!' after 4", body, requests)
+	}
+}
+
+func TestWaitForHTTPStatusTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no healthy upstream", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp, err := WaitForHTTPStatus(ctx, server.URL, http.StatusOK, time.Millisecond)
+	if nil != resp || nil == err || !strings.Contains(err.Error(), "503 Service Unavailable") {
+		t.Errorf("Expected timeout error with the last status, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	dockerTool = "docker"
+	craneTool  = "crane"
+
+	// Strategies of -imagenamestrategy
+	basenameStrategy = "basename"
+	fullStrategy     = "full"
+)
+
+var (
+	invalidImageChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+	repeatedSeparator = regexp.MustCompile(`[._-]{2,}`)
+	// validImageName matches the path of an image in a repo, e.g. foo/bar-baz
+	validImageName = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+)
+
+// SanitizeImageName turns an arbitrary string into a valid docker image name
+// component: lowercase alphanumerics separated by single '.', '_' or '-'.
+func SanitizeImageName(name string) string {
+	name = invalidImageChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = repeatedSeparator.ReplaceAllString(name, "-")
+	return strings.Trim(name, "._-")
+}
+
+// ComponentImage returns the image path for a component built in a given
+// language, see ImagePathForLanguage. All suites name images
+// "<component>-<language>", or just "<component>" when language is empty,
+// sanitized by SanitizeImageName.
+func ComponentImage(component, language string) string {
+	name := component
+	if "" != language {
+		name += "-" + language
+	}
+	return ImagePathForLanguage(SanitizeImageName(name), language)
+}
+
+// ImageForPath returns the image path of the component at componentPath in
+// the repo, named after the path with the strategy set by -imagenamestrategy:
+// "full" joins all the segments, cmd/foo/bar giving cmd-foo-bar, "basename"
+// drops the top-level directory, giving foo-bar.
+func ImageForPath(componentPath string) string {
+	segments := strings.Split(strings.Trim(path.Clean(componentPath), "/"), "/")
+	if basenameStrategy == Flags.ImageNameStrategy && len(segments) > 1 {
+		segments = segments[1:]
+	}
+	return ImagePath(SanitizeImageName(strings.Join(segments, "-")))
+}
+
+// GetImageLabels returns the labels in the config of the image ImagePath(name),
+// read with the tool set by -imagetool.
+func GetImageLabels(name string) (map[string]string, error) {
+	ref := ImagePath(name)
+	var labels map[string]string
+	switch Flags.ImageTool {
+	case dockerTool:
+		out, err := runCommand(context.Background(), nil, dockerTool, "image", "inspect", "--format", "{{json .Config.Labels}}", ref)
+		if nil != err {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(out), &labels); nil != err {
+			return nil, fmt.Errorf("failed parsing labels of image '%s': %v", ref, err)
+		}
+	case craneTool:
+		out, err := runCommand(context.Background(), nil, craneTool, "config", ref)
+		if nil != err {
+			return nil, err
+		}
+		var config struct {
+			Config struct {
+				Labels map[string]string `json:"Labels"`
+			} `json:"config"`
+		}
+		if err = json.Unmarshal([]byte(out), &config); nil != err {
+			return nil, fmt.Errorf("failed parsing config of image '%s': %v", ref, err)
+		}
+		labels = config.Config.Labels
+	default:
+		return nil, fmt.Errorf("unsupported image tool '%s'", Flags.ImageTool)
+	}
+	if nil == labels {
+		labels = map[string]string{}
+	}
+	return labels, nil
+}
+
+// RequireImageLabels returns an error listing every label of want missing from
+// the image ImagePath(name) or having a different value.
+func RequireImageLabels(name string, want map[string]string) error {
+	labels, err := GetImageLabels(name)
+	if nil != err {
+		return err
+	}
+	var mismatches []string
+	for k, v := range want {
+		if got, ok := labels[k]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: missing, want '%s'", k, v))
+		} else if got != v {
+			mismatches = append(mismatches, fmt.Sprintf("%s: got '%s', want '%s'", k, got, v))
+		}
+	}
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return fmt.Errorf("image '%s' has unexpected labels: %s", ImagePath(name), strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// ImageDigest resolves the image reference ref to its digest in the registry,
+// using the tool set by -imagetool.
+func ImageDigest(ctx context.Context, ref string) (string, error) {
+	var digest string
+	var err error
+	switch Flags.ImageTool {
+	case dockerTool:
+		// docker can't query a remote registry by itself, use gcloud instead
+		digest, err = gcloud(ctx, "container", "images", "describe", ref, "--format=value(image_summary.digest)")
+	case craneTool:
+		digest, err = runCommand(ctx, nil, craneTool, "digest", ref)
+	default:
+		err = fmt.Errorf("unsupported image tool '%s'", Flags.ImageTool)
+	}
+	if nil != err {
+		return "", err
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("failed resolving digest of image '%s', got '%s'", ref, digest)
+	}
+	return digest, nil
+}
+
+// PromoteImage tags the image name:fromTag with toTag in the registry without
+// rebuilding it. The source is resolved to a digest first, so that the
+// promoted image is exactly the one resolved even if fromTag moves meanwhile.
+func PromoteImage(ctx context.Context, name, fromTag, toTag string) error {
+	repo := fmt.Sprintf("%s/%s", Flags.DockerRepo, name)
+	digest, err := ImageDigest(ctx, repo+":"+fromTag)
+	if nil != err {
+		return err
+	}
+	src := repo + "@" + digest
+	switch Flags.ImageTool {
+	case dockerTool:
+		_, err = gcloud(ctx, "container", "images", "add-tag", src, repo+":"+toTag, "--quiet")
+	case craneTool:
+		_, err = runCommand(ctx, nil, craneTool, "tag", src, toTag)
+	}
+	return err
+}
+
+// GetImageSize returns the size in bytes of the image ImagePath(name): with
+// crane, the sum of its compressed layers in the registry, with docker, the
+// size of the local image.
+func GetImageSize(name string) (int64, error) {
+	ref := ImagePath(name)
+	switch Flags.ImageTool {
+	case dockerTool:
+		out, err := runCommand(context.Background(), nil, dockerTool, "image", "inspect", "--format", "{{.Size}}", ref)
+		if nil != err {
+			return 0, err
+		}
+		size, err := strconv.ParseInt(out, 10, 64)
+		if nil != err {
+			return 0, fmt.Errorf("failed parsing size of image '%s': %v", ref, err)
+		}
+		return size, nil
+	case craneTool:
+		out, err := runCommand(context.Background(), nil, craneTool, "manifest", ref)
+		if nil != err {
+			return 0, err
+		}
+		var manifest struct {
+			Layers []struct {
+				Size int64 `json:"size"`
+			} `json:"layers"`
+		}
+		if err = json.Unmarshal([]byte(out), &manifest); nil != err {
+			return 0, fmt.Errorf("failed parsing manifest of image '%s': %v", ref, err)
+		}
+		var size int64
+		for _, l := range manifest.Layers {
+			size += l.Size
+		}
+		return size, nil
+	default:
+		return 0, fmt.Errorf("unsupported image tool '%s'", Flags.ImageTool)
+	}
+}
+
+// RequireImageUnderSize returns an error if the image ImagePath(name) is
+// larger than maxBytes.
+func RequireImageUnderSize(name string, maxBytes int64) error {
+	size, err := GetImageSize(name)
+	if nil != err {
+		return err
+	}
+	if size > maxBytes {
+		return fmt.Errorf("image '%s' is %d bytes, over the budget of %d bytes", ImagePath(name), size, maxBytes)
+	}
+	return nil
+}
+
+// SignatureError is returned by VerifyImageSignature when cosign ran but the
+// image has no valid signature.
+type SignatureError struct {
+	Image  string
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("image '%s' has no valid signature: %s", e.Image, e.Reason)
+}
+
+// VerifyImageSignature verifies with cosign that the image ImagePath(name) is
+// signed with -cosignkey, or keyless by an identity of -cosignoidc. An image
+// without valid signature is reported as a *SignatureError, other errors mean
+// cosign couldn't verify the image at all.
+func VerifyImageSignature(ctx context.Context, name string) (bool, error) {
+	ref := ImagePath(name)
+	args := []string{"verify"}
+	switch {
+	case "" != Flags.CosignKey:
+		args = append(args, "--key", Flags.CosignKey)
+	case "" != Flags.CosignOIDCIssuer:
+		args = append(args, "--certificate-oidc-issuer", Flags.CosignOIDCIssuer, "--certificate-identity-regexp", ".*")
+	default:
+		return false, errors.New("verifying image signatures requires -cosignkey or -cosignoidc")
+	}
+	_, err := runCommand(ctx, nil, "cosign", append(args, ref)...)
+	if nil == err {
+		return true, nil
+	}
+	if ce, ok := err.(*CommandError); ok && 1 == ce.ExitCode {
+		for _, reason := range []string{"no matching signatures", "no signatures found", "signature verification failed"} {
+			if strings.Contains(ce.Stderr, reason) {
+				return false, &SignatureError{Image: ref, Reason: ce.Stderr}
+			}
+		}
+	}
+	return false, err
+}
+
+// AttestationRef returns the reference of the attestations of the image
+// ImagePath(name), tagged sha256-<digest>.att in the image repository as
+// cosign does, e.g. gcr.io/foo/bar:sha256-4f53...e8.att.
+func AttestationRef(name string) (string, error) {
+	ref := ImagePath(name)
+	digest, err := ImageDigest(context.Background(), ref)
+	if nil != err {
+		return "", err
+	}
+	repo := ref
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repo = ref[:i]
+	}
+	return repo + ":" + strings.Replace(digest, ":", "-", 1) + ".att", nil
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeImageName(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"helloworld", "helloworld"},
+		{"Hello World", "hello-world"},
+		{"-foo__bar..baz-", "foo-bar-baz"},
+		{"foo/bar:baz", "foo-bar-baz"},
+	} {
+		if got := SanitizeImageName(tc.in); got != tc.want {
+			t.Errorf("SanitizeImageName(%q) = '%s', want '%s'", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestComponentImage(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+
+	for _, tc := range []struct {
+		component string
+		language  string
+		want      string
+	}{
+		{"helloworld", "", "gcr.io/knative-samples/helloworld:v1"},
+		{"helloworld", "go", "gcr.io/knative-samples/helloworld-go:v1"},
+		{"Hello World", "C#", "gcr.io/knative-samples/hello-world-c:v1"},
+	} {
+		if got := ComponentImage(tc.component, tc.language); got != tc.want {
+			t.Errorf("ComponentImage(%q, %q) = '%s', want '%s'", tc.component, tc.language, got, tc.want)
+		}
+	}
+}
+
+func TestGetImageLabels(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+	want := map[string]string{"org.opencontainers.image.revision": "abc123"}
+
+	for _, tc := range []struct {
+		tool    string
+		out     string
+		command string
+	}{
+		{"docker", `{"org.opencontainers.image.revision":"abc123"}`,
+			"docker image inspect --format {{json .Config.Labels}} gcr.io/knative-samples/helloworld-go:v1"},
+		{"crane", `{"architecture":"amd64","config":{"Labels":{"org.opencontainers.image.revision":"abc123"}}}`,
+			"crane config gcr.io/knative-samples/helloworld-go:v1"},
+	} {
+		Flags.ImageTool = tc.tool
+		f, restore := useFakeRunner(fakeResult{out: tc.out})
+		got, err := GetImageLabels("helloworld-go")
+		restore()
+		if nil != err || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got labels %v (error: %v), want %v", tc.tool, got, err, want)
+		}
+		if tc.command != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.tool, f.calls[0], tc.command)
+		}
+	}
+}
+
+func TestRequireImageLabels(t *testing.T) {
+	defer saveFlags()()
+	Flags.ImageTool = "crane"
+	_, restore := useFakeRunner(fakeResult{out: `{"config":{"Labels":{"revision":"abc123","build-date":"2019-10-01"}}}`})
+	defer restore()
+
+	if err := RequireImageLabels("helloworld-go", map[string]string{"revision": "abc123"}); nil != err {
+		t.Errorf("Expected labels to match, got %v", err)
+	}
+	err := RequireImageLabels("helloworld-go", map[string]string{"revision": "def456", "source": "github"})
+	if nil == err || !strings.Contains(err.Error(), "revision: got 'abc123', want 'def456'") ||
+		!strings.Contains(err.Error(), "source: missing") {
+		t.Errorf("Expected mismatch error, got %v", err)
+	}
+}
+
+func TestPromoteImage(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	digest := "sha256:0123456789abcdef"
+
+	for _, tc := range []struct {
+		tool string
+		want []string
+	}{
+		{"docker", []string{
+			"gcloud container images describe gcr.io/knative-samples/helloworld-go:rc --format=value(image_summary.digest)",
+			"gcloud container images add-tag gcr.io/knative-samples/helloworld-go@" + digest + " gcr.io/knative-samples/helloworld-go:stable --quiet",
+		}},
+		{"crane", []string{
+			"crane digest gcr.io/knative-samples/helloworld-go:rc",
+			"crane tag gcr.io/knative-samples/helloworld-go@" + digest + " stable",
+		}},
+	} {
+		Flags.ImageTool = tc.tool
+		f, restore := useFakeRunner(fakeResult{out: digest}, fakeResult{})
+		err := PromoteImage(context.Background(), "helloworld-go", "rc", "stable")
+		restore()
+		if nil != err {
+			t.Errorf("%s: failed promoting image: %v", tc.tool, err)
+		}
+		if got := f.commands(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got commands %v, want %v", tc.tool, got, tc.want)
+		}
+	}
+}
+
+func TestPromoteImageUnresolved(t *testing.T) {
+	defer saveFlags()()
+	Flags.ImageTool = "crane"
+	f, restore := useFakeRunner(fakeResult{err: exitErr(1, "MANIFEST_UNKNOWN")})
+	defer restore()
+
+	if err := PromoteImage(context.Background(), "helloworld-go", "rc", "stable"); nil == err {
+		t.Error("Expected an error when the source can't be resolved, got nil")
+	}
+	if 1 != len(f.calls) {
+		t.Errorf("Expected no tagging after a failed resolution, got %v", f.commands())
+	}
+}
+
+func TestImageForPath(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+
+	for _, tc := range []struct {
+		strategy string
+		path     string
+		want     string
+	}{
+		{"basename", "cmd/foo/bar", "gcr.io/knative-samples/foo-bar:v1"},
+		{"full", "cmd/foo/bar", "gcr.io/knative-samples/cmd-foo-bar:v1"},
+		{"basename", "helloworld", "gcr.io/knative-samples/helloworld:v1"},
+		{"full", "./docs/Hello_World/helloworld-go/", "gcr.io/knative-samples/docs-hello_world-helloworld-go:v1"},
+	} {
+		Flags.ImageNameStrategy = tc.strategy
+		if got := ImageForPath(tc.path); tc.want != got {
+			t.Errorf("ImageForPath(%q) with strategy %s = '%s', want '%s'", tc.path, tc.strategy, got, tc.want)
+		}
+	}
+
+	Flags.ImageNameStrategy = "dirname"
+	if err := Flags.Validate(); nil == err {
+		t.Error("Expected an error for an unsupported -imagenamestrategy, got nil")
+	}
+}
+
+func TestGetImageSize(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+
+	for _, tc := range []struct {
+		tool    string
+		out     string
+		command string
+	}{
+		{"docker", "3000", "docker image inspect --format {{.Size}} gcr.io/knative-samples/helloworld-go:v1"},
+		{"crane", `{"schemaVersion":2,"config":{"size":500},"layers":[{"size":1000},{"size":2000}]}`,
+			"crane manifest gcr.io/knative-samples/helloworld-go:v1"},
+	} {
+		Flags.ImageTool = tc.tool
+		f, restore := useFakeRunner(fakeResult{out: tc.out})
+		size, err := GetImageSize("helloworld-go")
+		underErr := RequireImageUnderSize("helloworld-go", 3000)
+		overErr := RequireImageUnderSize("helloworld-go", 2999)
+		restore()
+		if nil != err || 3000 != size {
+			t.Errorf("%s: got size %d (error: %v), want 3000", tc.tool, size, err)
+		}
+		if tc.command != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.tool, f.calls[0], tc.command)
+		}
+		if nil != underErr {
+			t.Errorf("%s: expected the image to be within budget, got %v", tc.tool, underErr)
+		}
+		if nil == overErr || !strings.Contains(overErr.Error(), "over the budget of 2999 bytes") {
+			t.Errorf("%s: expected an over budget error, got %v", tc.tool, overErr)
+		}
+	}
+}
+
+func TestVerifyImageSignature(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+	for _, tc := range []struct {
+		name        string
+		key, issuer string
+		result      fakeResult
+		want        bool
+		wantSigErr  bool
+		wantErr     bool
+		wantCommand string
+	}{{
+		name:        "verified with key",
+		key:         "cosign.pub",
+		result:      fakeResult{out: `[{"critical":{"image":{"docker-manifest-digest":"sha256:4f53"}}}]`},
+		want:        true,
+		wantCommand: "cosign verify --key cosign.pub gcr.io/knative-samples/helloworld-go:v1",
+	}, {
+		name:        "verified keyless",
+		issuer:      "https://accounts.google.com",
+		want:        true,
+		wantCommand: "cosign verify --certificate-oidc-issuer https://accounts.google.com --certificate-identity-regexp .* gcr.io/knative-samples/helloworld-go:v1",
+	}, {
+		name:       "unsigned",
+		key:        "cosign.pub",
+		result:     fakeResult{err: exitErr(1, "Error: no matching signatures:\nmain.go:69: error during command execution: no matching signatures:")},
+		wantSigErr: true,
+		wantErr:    true,
+	}, {
+		name:    "cosign missing",
+		key:     "cosign.pub",
+		result:  fakeResult{err: exitErr(-1, `exec: "cosign": executable file not found in $PATH`)},
+		wantErr: true,
+	}, {
+		name:    "no key nor issuer",
+		wantErr: true,
+	}} {
+		Flags.CosignKey = tc.key
+		Flags.CosignOIDCIssuer = tc.issuer
+		f, restore := useFakeRunner(tc.result)
+		got, err := VerifyImageSignature(context.Background(), "helloworld-go")
+		restore()
+		_, isSigErr := err.(*SignatureError)
+		if tc.want != got || (nil != err) != tc.wantErr || tc.wantSigErr != isSigErr {
+			t.Errorf("%s: VerifyImageSignature() = %v, %v, want %v with error=%v, signature error=%v",
+				tc.name, got, err, tc.want, tc.wantErr, tc.wantSigErr)
+		}
+		if "" != tc.wantCommand && tc.wantCommand != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], tc.wantCommand)
+		}
+	}
+}
+
+func TestAttestationRef(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "localhost:5000/knative-samples"
+	Flags.Tag = "v1"
+	Flags.ImageTool = "crane"
+	digest := "sha256:4f53e6a1c8b2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8"
+	f, restore := useFakeRunner(fakeResult{out: digest})
+	got, err := AttestationRef("helloworld-go")
+	restore()
+	want := "localhost:5000/knative-samples/helloworld-go:sha256-4f53e6a1c8b2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8.att"
+	if nil != err || want != got {
+		t.Errorf("AttestationRef() = '%s', %v, want '%s'", got, err, want)
+	}
+	if cmd := "crane digest localhost:5000/knative-samples/helloworld-go:v1"; cmd != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], cmd)
+	}
+
+	_, restore = useFakeRunner(fakeResult{err: exitErr(1, "MANIFEST_UNKNOWN: manifest unknown")})
+	defer restore()
+	if got, err := AttestationRef("helloworld-go"); nil == err {
+		t.Errorf("Expected an error when the image can't be resolved, got '%s'", got)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	ingressAddressesMu sync.Mutex
+	ingressAddresses   = map[string]string{}
+)
+
+// GetIngressAddress returns the external IP or hostname of the ingress
+// controller Service, waiting for it to be assigned. Empty namespace and
+// service default to -ingressnamespace and -ingressservice. Addresses are
+// cached for the whole run.
+func GetIngressAddress(ctx context.Context, namespace, service string) (string, error) {
+	if "" == namespace {
+		namespace = Flags.IngressNamespace
+	}
+	if "" == service {
+		service = Flags.IngressService
+	}
+	key := namespace + "/" + service
+
+	ingressAddressesMu.Lock()
+	address, ok := ingressAddresses[key]
+	ingressAddressesMu.Unlock()
+	if ok {
+		return address, nil
+	}
+	// Waiting may take minutes, don't block the lookups of other addresses
+	address, err := WaitForServiceAddress(ctx, namespace, service, defaultPollInterval)
+	if nil != err {
+		return "", err
+	}
+	ingressAddressesMu.Lock()
+	ingressAddresses[key] = address
+	ingressAddressesMu.Unlock()
+	return address, nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetIngressAddress(t *testing.T) {
+	defer saveFlags()()
+	Flags.IngressNamespace = "istio-system"
+	Flags.IngressService = "istio-ingressgateway"
+
+	for _, tc := range []struct {
+		name string
+		out  string
+	}{
+		{"ip", "35.1.2.3"},
+		{"hostname", "a1b2.elb.amazonaws.com"},
+	} {
+		ingressAddresses = map[string]string{}
+		f, restore := useFakeRunner(fakeResult{out: tc.out})
+		got, err := GetIngressAddress(context.Background(), "", "")
+		if nil != err || tc.out != got {
+			t.Errorf("%s: got '%s' (error: %v), want '%s'", tc.name, got, err, tc.out)
+		}
+		// The second lookup is served from the cache
+		if got, _ = GetIngressAddress(context.Background(), "", ""); tc.out != got || 1 != len(f.calls) {
+			t.Errorf("%s: expected a single cached lookup, got '%s' after %d calls", tc.name, got, len(f.calls))
+		}
+		restore()
+		want := "kubectl get svc istio-ingressgateway -n istio-system -o " +
+			"jsonpath={.status.loadBalancer.ingress[0].ip}{.status.loadBalancer.ingress[0].hostname}"
+		if want != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+// Names of the containers added by InjectContainers.
+const (
+	injectedSidecarName = "injected-sidecar"
+	injectedInitName    = "injected-init"
+)
+
+// InjectableSpec is implemented by the pod specs of the deployments built by
+// the suites, so that InjectContainers can add containers to them.
+type InjectableSpec interface {
+	// AddContainer appends a container running image to the spec.
+	AddContainer(name, image string)
+	// AddInitContainer appends an init container running image to the spec.
+	AddInitContainer(name, image string)
+}
+
+// InjectedImages returns the references of the images set by
+// -injectsidecarimage and -injectinitimage, resolved like ImagePath, or empty
+// strings for the flags not set.
+func InjectedImages() (sidecar, init string) {
+	if "" != Flags.InjectSidecarImage {
+		sidecar = ImagePath(Flags.InjectSidecarImage)
+	}
+	if "" != Flags.InjectInitImage {
+		init = ImagePath(Flags.InjectInitImage)
+	}
+	return sidecar, init
+}
+
+// InjectContainers adds the containers of InjectedImages to spec, named
+// injected-sidecar and injected-init. Deployment builders must call it once on
+// every pod spec they build, after adding their own containers so that the
+// init container runs last. It doesn't change spec if neither flag is set.
+func InjectContainers(spec InjectableSpec) {
+	sidecar, init := InjectedImages()
+	if "" != init {
+		spec.AddInitContainer(injectedInitName, init)
+	}
+	if "" != sidecar {
+		spec.AddContainer(injectedSidecarName, sidecar)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fakeSpec records the containers added to it.
+type fakeSpec struct {
+	containers     []string
+	initContainers []string
+}
+
+func (s *fakeSpec) AddContainer(name, image string) {
+	s.containers = append(s.containers, name+"="+image)
+}
+
+func (s *fakeSpec) AddInitContainer(name, image string) {
+	s.initContainers = append(s.initContainers, name+"="+image)
+}
+
+func TestInjectContainers(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "v1"
+	Flags.InjectSidecarImage = "proxy"
+	Flags.InjectInitImage = "tools/wait-for-db"
+
+	sidecar, init := InjectedImages()
+	if "gcr.io/knative-samples/proxy:v1" != sidecar || "gcr.io/knative-samples/tools/wait-for-db:v1" != init {
+		t.Errorf("InjectedImages() = '%s', '%s', want the images in the Docker repo", sidecar, init)
+	}
+	spec := &fakeSpec{}
+	InjectContainers(spec)
+	want := &fakeSpec{
+		containers:     []string{"injected-sidecar=gcr.io/knative-samples/proxy:v1"},
+		initContainers: []string{"injected-init=gcr.io/knative-samples/tools/wait-for-db:v1"},
+	}
+	if !reflect.DeepEqual(want, spec) {
+		t.Errorf("Got containers %+v, want %+v", spec, want)
+	}
+}
+
+func TestInjectContainersNone(t *testing.T) {
+	defer saveFlags()()
+	Flags.InjectSidecarImage = ""
+	Flags.InjectInitImage = ""
+
+	if sidecar, init := InjectedImages(); "" != sidecar || "" != init {
+		t.Errorf("InjectedImages() = '%s', '%s', want no image", sidecar, init)
+	}
+	spec := &fakeSpec{}
+	InjectContainers(spec)
+	if 0 != len(spec.containers) || 0 != len(spec.initContainers) {
+		t.Errorf("Expected no injected container, got %+v", spec)
+	}
+}
+
+func TestValidateInjectedImages(t *testing.T) {
+	defer saveFlags()()
+	for _, tc := range []struct {
+		sidecar, init string
+		wantErr       bool
+	}{
+		{"", "", false},
+		{"proxy", "tools/wait-for-db", false},
+		{"Proxy", "", true},
+		{"", "gcr.io/foo:v1", true},
+	} {
+		Flags.InjectSidecarImage = tc.sidecar
+		Flags.InjectInitImage = tc.init
+		if err := Flags.Validate(); (nil != err) != tc.wantErr {
+			t.Errorf("Validate() with '%s', '%s' = %v, want error=%v", tc.sidecar, tc.init, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// DiffResource returns the differences between the manifests at path and the
+// live objects, as reported by `kubectl diff`. An empty string means no drift.
+func DiffResource(ctx context.Context, path string) (string, error) {
+	out, err := kubectl(ctx, "diff", "-f", path)
+	// kubectl diff exits with 1 when differences are found
+	if 1 == exitCode(err) {
+		return out, nil
+	}
+	return out, err
+}
+
+// maxLogRequests is the number of pods StreamPodLogs can follow at once,
+// kubectl refuses to follow more than 5 by default.
+const maxLogRequests = 100
+
+// StreamPodLogs follows the logs of the pods matching selector, copying them
+// to w prefixed by their pod and container until ctx is done. Cancelling ctx
+// is the normal way to stop streaming and is not reported as an error.
+func StreamPodLogs(ctx context.Context, namespace, selector string, w io.Writer) error {
+	args := kubectlArgs([]string{"logs", "-f", "-l", selector, "-n", namespace,
+		"--prefix", fmt.Sprintf("--max-log-requests=%d", maxLogRequests)})
+	if Flags.LogVerbose {
+		log.Printf("Streaming '%s'", commandLine("kubectl", args))
+	}
+	start := time.Now()
+	err := streamer(ctx, w, "kubectl", args...)
+	recordCommand(start, "kubectl", args, err)
+	if nil != ctx.Err() {
+		return nil
+	}
+	return err
+}
+
+// MergeKubeconfigs flattens the kubeconfig files at paths into a single
+// temporary kubeconfig holding all their contexts, and returns its path.
+// The caller is responsible for removing it.
+func MergeKubeconfigs(paths ...string) (mergedPath string, err error) {
+	if 0 == len(paths) {
+		return "", fmt.Errorf("no kubeconfig to merge")
+	}
+	env := []string{"KUBECONFIG=" + strings.Join(paths, string(os.PathListSeparator))}
+	out, err := runCommand(context.Background(), env, "kubectl", "config", "view", "--flatten")
+	if nil != err {
+		return "", err
+	}
+	f, err := ioutil.TempFile("", "kubeconfig-")
+	if nil != err {
+		return "", err
+	}
+	defer f.Close()
+	if _, err = f.WriteString(out + "\n"); nil != err {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// namespaceResourceKinds are the kinds checked by AssertNamespaceEmpty,
+// `all` doesn't include configuration nor storage.
+const namespaceResourceKinds = "all,configmap,secret,serviceaccount,pvc"
+
+// isDefaultNamespaceResource tells whether resource, as kind/name, is created
+// by Kubernetes in every namespace and doesn't count as a leftover.
+func isDefaultNamespaceResource(resource string) bool {
+	return "serviceaccount/default" == resource || "configmap/kube-root-ca.crt" == resource ||
+		// token of the default service account, before Kubernetes 1.24
+		strings.HasPrefix(resource, "secret/default-token-")
+}
+
+// AssertNamespaceEmpty returns an error listing the resources left in the
+// namespace, ignoring the ones Kubernetes creates in every namespace.
+func AssertNamespaceEmpty(ctx context.Context, namespace string) error {
+	out, err := kubectl(ctx, "get", namespaceResourceKinds, "-n", namespace, "--no-headers")
+	if nil != err {
+		return err
+	}
+	var leftovers []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if 0 == len(fields) || isDefaultNamespaceResource(fields[0]) {
+			continue
+		}
+		leftovers = append(leftovers, fields[0])
+	}
+	if len(leftovers) > 0 {
+		return fmt.Errorf("namespace '%s' is not empty: %s", namespace, strings.Join(leftovers, ", "))
+	}
+	return nil
+}
+
+// Strategies of -applystrategy
+const (
+	clientSideApply = "client"
+	serverSideApply = "server"
+)
+
+// applyFieldManager is the field manager of the fields applied server side by
+// ApplyOrdered.
+const applyFieldManager = "docs-e2e"
+
+// ServerSideApply applies the manifests at path with server-side apply as
+// fieldManager, so that fields managed by controllers don't conflict. With
+// -ssaforce, conflicting fields are taken over instead of failing.
+func ServerSideApply(ctx context.Context, path, namespace, fieldManager string) error {
+	args := []string{"apply", "--server-side", "--field-manager=" + fieldManager, "-f", path, "-n", namespace}
+	if Flags.SSAForce {
+		args = append(args, "--force-conflicts")
+	}
+	_, err := kubectl(ctx, args...)
+	return err
+}
+
+// imageDigestOf returns the sha256 digest of an image reference or ID, empty
+// if it has none.
+func imageDigestOf(ref string) string {
+	if i := strings.Index(ref, "@sha256:"); i >= 0 {
+		return ref[i+1:]
+	}
+	if strings.HasPrefix(ref, "sha256:") {
+		return ref
+	}
+	return ""
+}
+
+// AssertContainerImage returns an error if the container of the pod doesn't
+// run the image want. A tag and a digest are considered equivalent when the
+// image the container runs has the digest of want.
+func AssertContainerImage(ctx context.Context, namespace, pod, container, want string) error {
+	out, err := kubectl(ctx, "get", "pod", pod, "-n", namespace, "-o", fmt.Sprintf(
+		`jsonpath={.spec.containers[?(@.name=="%[1]s")].image} {.status.containerStatuses[?(@.name=="%[1]s")].imageID}`, container))
+	if nil != err {
+		return err
+	}
+	fields := strings.Fields(out)
+	if 0 == len(fields) {
+		return fmt.Errorf("pod %s/%s has no container '%s'", namespace, pod, container)
+	}
+	image, imageID := fields[0], ""
+	if len(fields) > 1 {
+		imageID = fields[1]
+	}
+	if want == image {
+		return nil
+	}
+	if digest := imageDigestOf(want); "" != digest && (digest == imageDigestOf(image) || digest == imageDigestOf(imageID)) {
+		return nil
+	}
+	return fmt.Errorf("container %s of pod %s/%s runs image '%s' (ID '%s'), want '%s'",
+		container, namespace, pod, image, imageID, want)
+}
+
+// randomSuffix returns a random string making the names of the resources
+// created by the tests unique.
+func randomSuffix() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); nil != err {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RunDebugPod runs args in a one-off pod of image, -debugimage if empty, in
+// the namespace, and returns the output. The pod is deleted once done.
+func RunDebugPod(ctx context.Context, namespace, image string, args ...string) (output string, err error) {
+	if "" == image {
+		image = Flags.DebugImage
+	}
+	suffix, err := randomSuffix()
+	if nil != err {
+		return "", err
+	}
+	name := "debug-" + suffix
+	output, err = kubectl(ctx, append([]string{"run", name, "--rm", "-i", "--restart=Never", "--image=" + image,
+		"-n", namespace, "--"}, args...)...)
+	if nil != err {
+		// --rm doesn't delete pods that failed to attach
+		kubectl(context.Background(), "delete", "pod", name, "-n", namespace, "--ignore-not-found")
+	}
+	return output, err
+}
+
+// DefaultPullSecret returns the first image pull secret of the default
+// service account of the namespace, which pods use unless they set their
+// own, or an empty string if there's none.
+func DefaultPullSecret(ctx context.Context, namespace string) (string, error) {
+	// Indexing fails when there's no secret, list them all instead
+	out, err := kubectl(ctx, "get", "sa", "default", "-n", namespace, "-o", "jsonpath={.imagePullSecrets[*].name}")
+	if fields := strings.Fields(out); nil == err && len(fields) > 0 {
+		return fields[0], nil
+	}
+	return "", err
+}
+
+// KubectlWait waits with `kubectl wait` for the resource, e.g. pod/foo or
+// deploy -l app=foo, to meet condition, e.g. condition=Ready or delete,
+// within the wait timeout, see -timeout.wait.
+func KubectlWait(ctx context.Context, resource, namespace, condition string) error {
+	args := append([]string{"wait"}, strings.Fields(resource)...)
+	args = append(args, "-n", namespace, "--for="+condition, "--timeout="+timeoutFor(waitClass).String())
+	if _, err := kubectl(ctx, args...); nil != err {
+		return fmt.Errorf("failed waiting for %s in %s to meet %s: %v", resource, namespace, condition, err)
+	}
+	return nil
+}
+
+// unhealthyReasons are the waiting reasons AssertNoUnhealthyPods reports even
+// for pods in the Running phase, which crashlooping pods stay in.
+var unhealthyReasons = map[string]bool{
+	"CrashLoopBackOff": true,
+	"ImagePullBackOff": true,
+	"ErrImagePull":     true,
+}
+
+// AssertNoUnhealthyPods returns an error naming every pod of the namespace
+// not Running nor Succeeded, or having a container crashlooping or failing to
+// pull its image.
+func AssertNoUnhealthyPods(ctx context.Context, namespace string) error {
+	out, err := kubectl(ctx, "get", "pods", "-n", namespace, "-o",
+		`jsonpath={range .items[*]}{.metadata.name}{"\t"}{.status.phase}{"\t"}{.status.containerStatuses[*].state.waiting.reason}{"\n"}{end}`)
+	if nil != err {
+		return err
+	}
+	var unhealthy []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pod, phase := fields[0], fields[1]
+		var reasons []string
+		for _, reason := range fields[2:] {
+			if unhealthyReasons[reason] {
+				reasons = append(reasons, reason)
+			}
+		}
+		switch {
+		case len(reasons) > 0:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", pod, strings.Join(reasons, ", ")))
+		case "Running" != phase && "Succeeded" != phase:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", pod, phase))
+		}
+	}
+	if len(unhealthy) > 0 {
+		return fmt.Errorf("namespace '%s' has unhealthy pods: %s", namespace, strings.Join(unhealthy, ", "))
+	}
+	return nil
+}
+
+// isNotFound tells whether err is kubectl failing on a missing resource.
+func isNotFound(err error) bool {
+	return nil != err && strings.Contains(err.Error(), "NotFound")
+}
+
+// SnapshotResource saves the resource kind/name of the namespace, and returns
+// a function restoring it by re-applying the saved manifest, or by deleting the
+// resource if it didn't exist when snapshotted.
+func SnapshotResource(ctx context.Context, kind, name, namespace string) (restore func(ctx context.Context) error, err error) {
+	manifest, err := kubectl(ctx, "get", kind, name, "-n", namespace, "-o", "yaml")
+	if isNotFound(err) {
+		return func(ctx context.Context) error {
+			_, err := kubectl(ctx, "delete", kind, name, "-n", namespace, "--ignore-not-found")
+			return err
+		}, nil
+	}
+	if nil != err {
+		return nil, err
+	}
+	// Drop the fields identifying the saved revision, so that applying it
+	// doesn't conflict with the revisions written by the test
+	var lines []string
+	for _, line := range strings.Split(manifest, "\n") {
+		if !strings.HasPrefix(line, "  resourceVersion:") && !strings.HasPrefix(line, "  uid:") {
+			lines = append(lines, line)
+		}
+	}
+	manifest = strings.Join(lines, "\n")
+	return func(ctx context.Context) error {
+		f, err := ioutil.TempFile("", "snapshot-")
+		if nil != err {
+			return err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(manifest + "\n")
+		if closeErr := f.Close(); nil == err {
+			err = closeErr
+		}
+		if nil != err {
+			return err
+		}
+		if _, err = kubectl(ctx, "apply", "-f", f.Name(), "-n", namespace); nil != err {
+			return fmt.Errorf("failed restoring %s/%s in %s: %v", kind, name, namespace, err)
+		}
+		return nil
+	}, nil
+}
+
+// AssertNoRestartsAfter waits for window, then returns an error naming every
+// container of the pods matching selector that restarted, e.g. because it
+// crashed during or after a rollout.
+func AssertNoRestartsAfter(ctx context.Context, namespace, selector string, window time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(window):
+	}
+	out, err := kubectl(ctx, "get", "pods", "-n", namespace, "-l", selector, "-o",
+		`jsonpath={range .items[*]}{.metadata.name}{"\t"}{range .status.containerStatuses[*]}{.name}={.restartCount}{" "}{end}{"\n"}{end}`)
+	if nil != err {
+		return err
+	}
+	var restarted []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if 0 == len(fields) {
+			continue
+		}
+		for _, status := range fields[1:] {
+			if kv := strings.SplitN(status, "=", 2); 2 == len(kv) && "0" != kv[1] {
+				restarted = append(restarted, fmt.Sprintf("%s/%s (%s restarts)", fields[0], kv[0], kv[1]))
+			}
+		}
+	}
+	if len(restarted) > 0 {
+		return fmt.Errorf("containers of pods %s in %s restarted: %s", selector, namespace, strings.Join(restarted, ", "))
+	}
+	return nil
+}
+
+// AssertResourceCondition returns an error, with the message of the condition,
+// unless the condition conditionType of the resource kind/name has the status
+// wantStatus, e.g. "True".
+func AssertResourceCondition(ctx context.Context, kind, name, namespace, conditionType, wantStatus string) error {
+	out, err := kubectl(ctx, "get", kind, name, "-n", namespace, "-o", fmt.Sprintf(
+		`jsonpath={.status.conditions[?(@.type=="%[1]s")].status}|{.status.conditions[?(@.type=="%[1]s")].message}`, conditionType))
+	if nil != err {
+		return err
+	}
+	parts := strings.SplitN(out, "|", 2)
+	if "" == parts[0] {
+		return fmt.Errorf("%s %s/%s has no condition %s", kind, namespace, name, conditionType)
+	}
+	if wantStatus != parts[0] {
+		message := ""
+		if 2 == len(parts) {
+			message = parts[1]
+		}
+		return fmt.Errorf("%s %s/%s has condition %s=%s, want %s: %s", kind, namespace, name, conditionType, parts[0], wantStatus, message)
+	}
+	return nil
+}
+
+// crdPrefix prefixes the names of CustomResourceDefinitions printed by
+// `kubectl apply -o name`.
+const crdPrefix = "customresourcedefinition.apiextensions.k8s.io/"
+
+// WaitForCRDEstablished waits for the CustomResourceDefinitions named crds,
+// e.g. brokers.eventing.knative.dev, to be served, within the wait timeout,
+// see -timeout.wait.
+func WaitForCRDEstablished(ctx context.Context, crds ...string) error {
+	if 0 == len(crds) {
+		return nil
+	}
+	args := []string{"wait"}
+	for _, crd := range crds {
+		args = append(args, "crd/"+crd)
+	}
+	args = append(args, "--for=condition=Established", "--timeout="+timeoutFor(waitClass).String())
+	if _, err := kubectl(ctx, args...); nil != err {
+		return fmt.Errorf("failed waiting for CRDs %s to be established: %v", strings.Join(crds, ", "), err)
+	}
+	return nil
+}
+
+// ApplyOrdered applies the manifests at paths one after the other with the
+// strategy set by -applystrategy. With waitForCRDs, it waits for the CRDs of
+// each manifest to be established before applying the next one, so that
+// manifests can hold resources of the CRDs of the previous ones.
+func ApplyOrdered(ctx context.Context, paths []string, waitForCRDs bool) error {
+	for _, path := range paths {
+		args := []string{"apply", "-f", path, "-o", "name"}
+		if serverSideApply == Flags.ApplyStrategy {
+			args = append(args, "--server-side", "--field-manager="+applyFieldManager)
+			if Flags.SSAForce {
+				args = append(args, "--force-conflicts")
+			}
+		}
+		out, err := kubectl(ctx, args...)
+		if nil != err {
+			return fmt.Errorf("failed applying %s: %v", path, err)
+		}
+		if !waitForCRDs {
+			continue
+		}
+		var crds []string
+		for _, applied := range strings.Fields(out) {
+			if strings.HasPrefix(applied, crdPrefix) {
+				crds = append(crds, strings.TrimPrefix(applied, crdPrefix))
+			}
+		}
+		if err = WaitForCRDEstablished(ctx, crds...); nil != err {
+			return err
+		}
+	}
+	return nil
+}
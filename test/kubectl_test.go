@@ -0,0 +1,451 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffResource(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		result  fakeResult
+		want    string
+		wantErr bool
+	}{
+		{"no diff", fakeResult{}, "", false},
+		{"has diff", fakeResult{out: "-  replicas: 1\n+  replicas: 2", err: exitErr(1, "")}, "-  replicas: 1\n+  replicas: 2", false},
+		{"error", fakeResult{err: exitErr(2, "error: the path does not exist")}, "", true},
+	} {
+		f, restore := useFakeRunner(tc.result)
+		got, err := DiffResource(context.Background(), "service.yaml")
+		restore()
+		if got != tc.want || (nil != err) != tc.wantErr {
+			t.Errorf("%s: got '%s', %v, want '%s' with error=%v", tc.name, got, err, tc.want, tc.wantErr)
+		}
+		if want := "kubectl diff -f service.yaml"; want != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], want)
+		}
+	}
+}
+
+func TestStreamPodLogs(t *testing.T) {
+	started := make(chan struct{})
+	var gotArgs []string
+	saved := streamer
+	defer func() { streamer = saved }()
+	streamer = func(ctx context.Context, w io.Writer, name string, args ...string) error {
+		gotArgs = append([]string{name}, args...)
+		fmt.Fprintln(w, "line 1")
+		fmt.Fprintln(w, "line 2")
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	var buf bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- StreamPodLogs(ctx, "default", "app=helloworld-go", &buf) }()
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		if nil != err {
+			t.Errorf("Expected cancellation to stop streaming cleanly, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Streaming did not stop on cancellation")
+	}
+	if want := "line 1\nline 2\n"; want != buf.String() {
+		t.Errorf("Got logs '%s', want '%s'", buf.String(), want)
+	}
+	if want := "kubectl logs -f -l app=helloworld-go -n default --prefix --max-log-requests=100"; want != strings.Join(gotArgs, " ") {
+		t.Errorf("Got command '%s', want '%s'", strings.Join(gotArgs, " "), want)
+	}
+}
+
+func TestMergeKubeconfigs(t *testing.T) {
+	merged := "apiVersion: v1\nkind: Config"
+	f, restore := useFakeRunner(fakeResult{out: merged})
+	defer restore()
+
+	path, err := MergeKubeconfigs("/tmp/a.yaml", "/tmp/b.yaml")
+	if nil != err {
+		t.Fatalf("Failed merging kubeconfigs: %v", err)
+	}
+	defer os.Remove(path)
+
+	if want := "kubectl config view --flatten"; want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+	if want := []string{"KUBECONFIG=/tmp/a.yaml:/tmp/b.yaml"}; !reflect.DeepEqual(f.calls[0].env, want) {
+		t.Errorf("Got env %v, want %v", f.calls[0].env, want)
+	}
+	content, err := ioutil.ReadFile(path)
+	if nil != err || merged+"\n" != string(content) {
+		t.Errorf("Expected merged kubeconfig in '%s', got '%s' (error: %v)", path, content, err)
+	}
+}
+
+func TestAssertNamespaceEmpty(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: `configmap/kube-root-ca.crt   1     5m
+secret/default-token-x7k2p   kubernetes.io/service-account-token   3     5m
+serviceaccount/default   1     5m`})
+	if err := AssertNamespaceEmpty(context.Background(), "test-ns"); nil != err {
+		t.Errorf("Expected an empty namespace, got %v", err)
+	}
+	restore()
+	if want := "kubectl get all,configmap,secret,serviceaccount,pvc -n test-ns --no-headers"; want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+
+	_, restore = useFakeRunner(fakeResult{out: `pod/helloworld-go-7d9f5c8b4-x2hzk   1/1   Running   0     2m
+service/helloworld-go   ClusterIP   10.0.0.12   <none>   80/TCP   2m
+configmap/kube-root-ca.crt   1     5m
+configmap/helloworld-config   2     2m
+persistentvolumeclaim/data   Bound   pvc-1234   1Gi   RWO   standard   2m
+serviceaccount/default   1     5m`})
+	defer restore()
+	err := AssertNamespaceEmpty(context.Background(), "test-ns")
+	want := "pod/helloworld-go-7d9f5c8b4-x2hzk, service/helloworld-go, configmap/helloworld-config, persistentvolumeclaim/data"
+	if nil == err || !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected an error listing '%s', got %v", want, err)
+	}
+}
+
+func TestMergeKubeconfigsNoPath(t *testing.T) {
+	f, restore := useFakeRunner()
+	defer restore()
+	if _, err := MergeKubeconfigs(); nil == err || 0 != len(f.calls) {
+		t.Errorf("Expected an error without running kubectl, got %v after %v", err, f.commands())
+	}
+}
+
+func TestServerSideApply(t *testing.T) {
+	defer saveFlags()()
+	for _, tc := range []struct {
+		force bool
+		want  string
+	}{
+		{false, "kubectl apply --server-side --field-manager=docs-e2e -f service.yaml -n default"},
+		{true, "kubectl apply --server-side --field-manager=docs-e2e -f service.yaml -n default --force-conflicts"},
+	} {
+		Flags.SSAForce = tc.force
+		f, restore := useFakeRunner()
+		err := ServerSideApply(context.Background(), "service.yaml", "default", "docs-e2e")
+		restore()
+		if nil != err || tc.want != f.calls[0].String() {
+			t.Errorf("-ssaforce=%v: got command '%s' (error: %v), want '%s'", tc.force, f.calls[0], err, tc.want)
+		}
+	}
+}
+
+func TestAssertContainerImage(t *testing.T) {
+	digest := "sha256:4f53e6a1c8b2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8"
+	running := "gcr.io/knative-samples/helloworld-go:v1 docker-pullable://gcr.io/knative-samples/helloworld-go@" + digest
+	for _, tc := range []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"match", "gcr.io/knative-samples/helloworld-go:v1", false},
+		{"digest match", "gcr.io/knative-samples/helloworld-go@" + digest, false},
+		{"mismatch", "gcr.io/knative-samples/helloworld-go:v2", true},
+	} {
+		f, restore := useFakeRunner(fakeResult{out: running})
+		err := AssertContainerImage(context.Background(), "default", "helloworld-go-abc", "user-container", tc.want)
+		restore()
+		if (nil != err) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error=%v", tc.name, err, tc.wantErr)
+		}
+		if nil != err && !strings.Contains(err.Error(), "runs image 'gcr.io/knative-samples/helloworld-go:v1'") {
+			t.Errorf("%s: expected the running image in the error, got %v", tc.name, err)
+		}
+		want := `kubectl get pod helloworld-go-abc -n default -o jsonpath={.spec.containers[?(@.name=="user-container")].image} ` +
+			`{.status.containerStatuses[?(@.name=="user-container")].imageID}`
+		if want != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], want)
+		}
+	}
+}
+
+func TestRunDebugPod(t *testing.T) {
+	defer saveFlags()()
+	Flags.DebugImage = "busybox"
+	f, restore := useFakeRunner(fakeResult{out: "Hello Go Sample v1!"})
+	defer restore()
+
+	out, err := RunDebugPod(context.Background(), "default", "", "wget", "-qO-", "http://helloworld-go")
+	if nil != err || "Hello Go Sample v1!" != out {
+		t.Errorf("Expected the output of the pod, got '%s' (error: %v)", out, err)
+	}
+	args := f.calls[0].args
+	if 1 != len(f.calls) || len(args) < 2 || "run" != args[0] || !strings.HasPrefix(args[1], "debug-") {
+		t.Fatalf("Expected a single kubectl run of a debug pod, got %v", f.commands())
+	}
+	want := "kubectl run " + args[1] + " --rm -i --restart=Never --image=busybox -n default -- wget -qO- http://helloworld-go"
+	if want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+}
+
+func TestRunDebugPodFailure(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{err: exitErr(1, "timed out waiting for the condition")}, fakeResult{})
+	defer restore()
+
+	if _, err := RunDebugPod(context.Background(), "default", "curlimages/curl", "curl", "http://helloworld-go"); nil == err {
+		t.Error("Expected an error, got nil")
+	}
+	if 2 != len(f.calls) || !strings.HasPrefix(f.calls[1].String(), "kubectl delete pod debug-") {
+		t.Errorf("Expected the debug pod to be deleted, got %v", f.commands())
+	}
+}
+
+func TestDefaultPullSecret(t *testing.T) {
+	for _, tc := range []struct {
+		out  string
+		want string
+	}{
+		{"gcr-pull", "gcr-pull"},
+		{"gcr-pull docker-hub", "gcr-pull"},
+		{"", ""},
+	} {
+		f, restore := useFakeRunner(fakeResult{out: tc.out})
+		got, err := DefaultPullSecret(context.Background(), "default")
+		restore()
+		if nil != err || tc.want != got {
+			t.Errorf("DefaultPullSecret() with secrets '%s' = '%s', %v, want '%s'", tc.out, got, err, tc.want)
+		}
+		if cmd := "kubectl get sa default -n default -o jsonpath={.imagePullSecrets[*].name}"; cmd != f.calls[0].String() {
+			t.Errorf("Got command '%s', want '%s'", f.calls[0], cmd)
+		}
+	}
+}
+
+func TestKubectlWait(t *testing.T) {
+	defer saveFlags()()
+	Flags.WaitTimeout = 5 * time.Minute
+	f, restore := useFakeRunner()
+	defer restore()
+
+	if err := KubectlWait(context.Background(), "pod/helloworld-go", "default", "condition=Ready"); nil != err {
+		t.Errorf("Expected the wait to succeed, got %v", err)
+	}
+	if want := "kubectl wait pod/helloworld-go -n default --for=condition=Ready --timeout=5m0s"; want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+}
+
+func TestKubectlWaitFailure(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{err: exitErr(1, "error: timed out waiting for the condition on pods/helloworld-go")})
+	defer restore()
+
+	err := KubectlWait(context.Background(), "pod/helloworld-go", "default", "condition=Ready")
+	if nil == err || !strings.Contains(err.Error(), "timed out waiting for the condition on pods/helloworld-go") {
+		t.Errorf("Expected an error with the stderr of kubectl, got %v", err)
+	}
+}
+
+func TestAssertNoUnhealthyPods(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "helloworld-go-7d9f5c8b4-x2hzk\tRunning\t\nmigrate-db-5x8kq\tSucceeded\t\n"})
+	if err := AssertNoUnhealthyPods(context.Background(), "test-ns"); nil != err {
+		t.Errorf("Expected healthy pods, got %v", err)
+	}
+	restore()
+	want := `kubectl get pods -n test-ns -o jsonpath={range .items[*]}{.metadata.name}{"\t"}{.status.phase}{"\t"}` +
+		`{.status.containerStatuses[*].state.waiting.reason}{"\n"}{end}`
+	if want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+
+	_, restore = useFakeRunner(fakeResult{out: "helloworld-go-7d9f5c8b4-x2hzk\tRunning\t\n" +
+		"helloworld-java-6c8d7f9b5-q4wzn\tRunning\tCrashLoopBackOff\n" +
+		"pending-5f7b9c-kx2pl\tPending\tContainerCreating\n"})
+	defer restore()
+	err := AssertNoUnhealthyPods(context.Background(), "test-ns")
+	wantErr := "helloworld-java-6c8d7f9b5-q4wzn (CrashLoopBackOff), pending-5f7b9c-kx2pl (Pending)"
+	if nil == err || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("Expected an error naming '%s', got %v", wantErr, err)
+	}
+}
+
+func TestSnapshotResource(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: `apiVersion: v1
+data:
+  greeting: Hello
+kind: ConfigMap
+metadata:
+  name: helloworld-config
+  namespace: default
+  resourceVersion: "4213"
+  uid: 9b2f4c1e-7a3d-4e8b-b1c2-3d4e5f6a7b8c`})
+	defer restore()
+
+	restoreResource, err := SnapshotResource(context.Background(), "configmap", "helloworld-config", "default")
+	if nil != err {
+		t.Fatalf("Failed snapshotting the resource: %v", err)
+	}
+	if want := "kubectl get configmap helloworld-config -n default -o yaml"; want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+
+	var applied string
+	f.handler = func(c fakeCall) fakeResult {
+		if len(c.args) > 2 {
+			content, _ := ioutil.ReadFile(c.args[2])
+			applied = string(content)
+		}
+		return fakeResult{}
+	}
+	if err = restoreResource(context.Background()); nil != err {
+		t.Fatalf("Failed restoring the resource: %v", err)
+	}
+	args := f.calls[1].args
+	if 5 != len(args) || "apply" != args[0] || "-f" != args[1] || "-n default" != strings.Join(args[3:], " ") {
+		t.Errorf("Got command '%s', want 'kubectl apply -f <snapshot> -n default'", f.calls[1])
+	}
+	if !strings.Contains(applied, "greeting: Hello") || strings.Contains(applied, "resourceVersion") || strings.Contains(applied, "uid:") {
+		t.Errorf("Expected the snapshot without its revision to be applied, got '%s'", applied)
+	}
+}
+
+func TestSnapshotMissingResource(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{err: exitErr(1, `Error from server (NotFound): configmaps "helloworld-config" not found`)}, fakeResult{})
+	defer restore()
+
+	restoreResource, err := SnapshotResource(context.Background(), "configmap", "helloworld-config", "default")
+	if nil != err {
+		t.Fatalf("Expected a missing resource to be snapshotted, got %v", err)
+	}
+	if err = restoreResource(context.Background()); nil != err {
+		t.Errorf("Failed restoring the resource: %v", err)
+	}
+	if want := "kubectl delete configmap helloworld-config -n default --ignore-not-found"; 2 != len(f.calls) || want != f.calls[1].String() {
+		t.Errorf("Expected restoring to run '%s', got %v", want, f.commands())
+	}
+}
+
+func TestAssertNoRestartsAfter(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "helloworld-go-7d9f5c8b4-x2hzk\tuser-container=0 queue-proxy=0 \n" +
+		"helloworld-go-7d9f5c8b4-q4wzn\tuser-container=0 queue-proxy=0 \n"})
+	if err := AssertNoRestartsAfter(context.Background(), "default", "app=helloworld-go", time.Millisecond); nil != err {
+		t.Errorf("Expected no restart, got %v", err)
+	}
+	restore()
+	want := `kubectl get pods -n default -l app=helloworld-go -o jsonpath={range .items[*]}{.metadata.name}{"\t"}` +
+		`{range .status.containerStatuses[*]}{.name}={.restartCount}{" "}{end}{"\n"}{end}`
+	if want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+
+	_, restore = useFakeRunner(fakeResult{out: "helloworld-go-7d9f5c8b4-x2hzk\tuser-container=0 queue-proxy=0 \n" +
+		"helloworld-go-7d9f5c8b4-q4wzn\tuser-container=3 queue-proxy=0 \n"})
+	defer restore()
+	err := AssertNoRestartsAfter(context.Background(), "default", "app=helloworld-go", time.Millisecond)
+	if nil == err || !strings.Contains(err.Error(), "helloworld-go-7d9f5c8b4-q4wzn/user-container (3 restarts)") {
+		t.Errorf("Expected an error naming the restarted container, got %v", err)
+	}
+}
+
+func TestAssertResourceCondition(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		out     string
+		wantErr string
+	}{
+		{"match", "True|", ""},
+		{"mismatch", `False|Revision "helloworld-go-00001" failed with message: Back-off pulling image.`,
+			`has condition Ready=False, want True: Revision "helloworld-go-00001" failed with message: Back-off pulling image.`},
+		{"absent", "|", "has no condition Ready"},
+	} {
+		f, restore := useFakeRunner(fakeResult{out: tc.out})
+		err := AssertResourceCondition(context.Background(), "ksvc", "helloworld-go", "default", "Ready", "True")
+		restore()
+		if ("" == tc.wantErr) != (nil == err) || (nil != err && !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: got error %v, want '%s'", tc.name, err, tc.wantErr)
+		}
+		want := `kubectl get ksvc helloworld-go -n default -o jsonpath={.status.conditions[?(@.type=="Ready")].status}|` +
+			`{.status.conditions[?(@.type=="Ready")].message}`
+		if want != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], want)
+		}
+	}
+}
+
+func TestApplyOrdered(t *testing.T) {
+	defer saveFlags()()
+	Flags.WaitTimeout = time.Minute
+	crds := "customresourcedefinition.apiextensions.k8s.io/brokers.eventing.knative.dev\n" +
+		"customresourcedefinition.apiextensions.k8s.io/triggers.eventing.knative.dev"
+	for _, tc := range []struct {
+		name        string
+		strategy    string
+		waitForCRDs bool
+		want        []string
+	}{{
+		name:        "client side with CRD waits",
+		strategy:    "client",
+		waitForCRDs: true,
+		want: []string{
+			"kubectl apply -f crds.yaml -o name",
+			"kubectl wait crd/brokers.eventing.knative.dev crd/triggers.eventing.knative.dev --for=condition=Established --timeout=1m0s",
+			"kubectl apply -f broker.yaml -o name",
+		},
+	}, {
+		name:     "server side without CRD waits",
+		strategy: "server",
+		want: []string{
+			"kubectl apply -f crds.yaml -o name --server-side --field-manager=docs-e2e",
+			"kubectl apply -f broker.yaml -o name --server-side --field-manager=docs-e2e",
+		},
+	}} {
+		Flags.ApplyStrategy = tc.strategy
+		f, restore := useFakeRunner()
+		f.handler = func(c fakeCall) fakeResult {
+			if "crds.yaml" == c.args[2] {
+				return fakeResult{out: crds}
+			}
+			return fakeResult{out: "broker.eventing.knative.dev/default"}
+		}
+		err := ApplyOrdered(context.Background(), []string{"crds.yaml", "broker.yaml"}, tc.waitForCRDs)
+		restore()
+		if nil != err || !reflect.DeepEqual(tc.want, f.commands()) {
+			t.Errorf("%s: got commands %v (error: %v), want %v", tc.name, f.commands(), err, tc.want)
+		}
+	}
+}
+
+func TestApplyOrderedCRDNotEstablished(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "customresourcedefinition.apiextensions.k8s.io/brokers.eventing.knative.dev"},
+		fakeResult{err: exitErr(1, "error: timed out waiting for the condition on customresourcedefinitions/brokers.eventing.knative.dev")})
+	defer restore()
+
+	err := ApplyOrdered(context.Background(), []string{"crds.yaml", "broker.yaml"}, true)
+	if nil == err || !strings.Contains(err.Error(), "brokers.eventing.knative.dev") || 2 != len(f.calls) {
+		t.Errorf("Expected to stop after the CRD wait failed, got %v after %v", err, f.commands())
+	}
+}
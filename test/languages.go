@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"io/ioutil"
+	"sort"
+)
+
+// KnownLanguages lists the languages sample apps exist for, it's empty unless
+// seeded with LoadKnownLanguages.
+var KnownLanguages []string
+
+// DiscoverLanguages returns the sorted names of the immediate subdirectories
+// of root, each being a language, e.g. helloworld-go's parent holds "go".
+// Files are ignored.
+func DiscoverLanguages(root string) ([]string, error) {
+	entries, err := ioutil.ReadDir(root)
+	if nil != err {
+		return nil, err
+	}
+	var languages []string
+	for _, e := range entries {
+		if e.IsDir() {
+			languages = append(languages, e.Name())
+		}
+	}
+	sort.Strings(languages)
+	return languages, nil
+}
+
+// LoadKnownLanguages seeds KnownLanguages with the languages discovered in root.
+func LoadKnownLanguages(root string) error {
+	languages, err := DiscoverLanguages(root)
+	if nil != err {
+		return err
+	}
+	KnownLanguages = languages
+	return nil
+}
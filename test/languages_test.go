@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverLanguages(t *testing.T) {
+	root, err := ioutil.TempDir("", "languages")
+	if nil != err {
+		t.Fatalf("Failed creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, l := range []string{"python", "go", "java"} {
+		if err = os.Mkdir(filepath.Join(root, l), 0755); nil != err {
+			t.Fatalf("Failed creating language dir: %v", err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(root, "README.md"), []byte("stray"), 0644); nil != err {
+		t.Fatalf("Failed creating stray file: %v", err)
+	}
+
+	want := []string{"go", "java", "python"}
+	got, err := DiscoverLanguages(root)
+	if nil != err || !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscoverLanguages() = %v, %v, want %v", got, err, want)
+	}
+
+	saved := KnownLanguages
+	defer func() { KnownLanguages = saved }()
+	if err = LoadKnownLanguages(root); nil != err || !reflect.DeepEqual(KnownLanguages, want) {
+		t.Errorf("LoadKnownLanguages() seeded %v (error: %v), want %v", KnownLanguages, err, want)
+	}
+}
+
+func TestDiscoverLanguagesMissingRoot(t *testing.T) {
+	if _, err := DiscoverLanguages("/does/not/exist"); nil == err {
+		t.Error("Expected an error for a missing root, got nil")
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"sort"
+)
+
+// EnsureNamespace creates the namespace if it doesn't exist, and sets the
+// labels of -namespacelabels on it whether it was created or not.
+func EnsureNamespace(ctx context.Context, namespace string) error {
+	_, err := kubectl(ctx, "get", "namespace", namespace, "-o", "name")
+	if isNotFound(err) {
+		_, err = kubectl(ctx, "create", "namespace", namespace)
+	}
+	if nil != err {
+		return err
+	}
+	return labelNamespace(ctx, namespace)
+}
+
+// labelNamespace sets the labels of -namespacelabels on the namespace.
+func labelNamespace(ctx context.Context, namespace string) error {
+	labels, _ := parsePairs(Flags.NamespaceLabels) // malformed pairs are reported by Validate
+	if 0 == len(labels) {
+		return nil
+	}
+	args := []string{"label", "namespace", namespace, "--overwrite"}
+	for k, v := range labels {
+		args = append(args, k+"="+v)
+	}
+	sort.Strings(args[4:])
+	_, err := kubectl(ctx, args...)
+	return err
+}
+
+// TestNamespace creates a namespace named after prefix with a random suffix,
+// labeled like EnsureNamespace, and returns it along with a function deleting
+// it, which callers should defer.
+func TestNamespace(ctx context.Context, prefix string) (namespace string, cleanup func() error, err error) {
+	suffix, err := randomSuffix()
+	if nil != err {
+		return "", nil, err
+	}
+	namespace = prefix + "-" + suffix
+	if _, err = kubectl(ctx, "create", "namespace", namespace); nil != err {
+		return "", nil, err
+	}
+	cleanup = func() error {
+		_, err := kubectl(context.Background(), "delete", "namespace", namespace, "--ignore-not-found", "--wait=false")
+		return err
+	}
+	if err = labelNamespace(ctx, namespace); nil != err {
+		cleanup()
+		return "", nil, err
+	}
+	return namespace, cleanup, nil
+}
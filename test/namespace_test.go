@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnsureNamespace(t *testing.T) {
+	defer saveFlags()()
+	Flags.NamespaceLabels = "pod-security.kubernetes.io/enforce=baseline,team=docs"
+	labelCmd := "kubectl label namespace test-ns --overwrite pod-security.kubernetes.io/enforce=baseline team=docs"
+	for _, tc := range []struct {
+		name    string
+		results []fakeResult
+		want    []string
+	}{{
+		name:    "created",
+		results: []fakeResult{{err: exitErr(1, `Error from server (NotFound): namespaces "test-ns" not found`)}, {}},
+		want:    []string{"kubectl get namespace test-ns -o name", "kubectl create namespace test-ns", labelCmd},
+	}, {
+		name:    "existing",
+		results: []fakeResult{{out: "namespace/test-ns"}, {}},
+		want:    []string{"kubectl get namespace test-ns -o name", labelCmd},
+	}} {
+		f, restore := useFakeRunner(tc.results...)
+		err := EnsureNamespace(context.Background(), "test-ns")
+		restore()
+		if nil != err || !reflect.DeepEqual(tc.want, f.commands()) {
+			t.Errorf("%s: got commands %v (error: %v), want %v", tc.name, f.commands(), err, tc.want)
+		}
+	}
+}
+
+func TestEnsureNamespaceNoLabels(t *testing.T) {
+	defer saveFlags()()
+	Flags.NamespaceLabels = ""
+	f, restore := useFakeRunner(fakeResult{out: "namespace/test-ns"})
+	defer restore()
+
+	if err := EnsureNamespace(context.Background(), "test-ns"); nil != err || 1 != len(f.calls) {
+		t.Errorf("Expected only checking the namespace exists, got %v (error: %v)", f.commands(), err)
+	}
+}
+
+func TestTestNamespace(t *testing.T) {
+	defer saveFlags()()
+	Flags.NamespaceLabels = "team=docs"
+	f, restore := useFakeRunner()
+	defer restore()
+
+	namespace, cleanup, err := TestNamespace(context.Background(), "helloworld")
+	if nil != err || !strings.HasPrefix(namespace, "helloworld-") {
+		t.Fatalf("TestNamespace() = '%s', %v, want a helloworld- namespace", namespace, err)
+	}
+	if err = cleanup(); nil != err {
+		t.Errorf("Failed deleting the namespace: %v", err)
+	}
+	want := []string{
+		"kubectl create namespace " + namespace,
+		"kubectl label namespace " + namespace + " --overwrite team=docs",
+		"kubectl delete namespace " + namespace + " --ignore-not-found --wait=false",
+	}
+	if !reflect.DeepEqual(want, f.commands()) {
+		t.Errorf("Got commands %v, want %v", f.commands(), want)
+	}
+}
+
+func TestValidateNamespaceLabels(t *testing.T) {
+	defer saveFlags()()
+	Flags.NamespaceLabels = "team=docs,enforce"
+	if err := Flags.Validate(); nil == err || !strings.Contains(err.Error(), "-namespacelabels") {
+		t.Errorf("Expected an error for a malformed -namespacelabels, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// countNodes returns how many nodes have each value of the field, a jsonpath
+// expression relative to a node.
+func countNodes(ctx context.Context, field string) (map[string]int, error) {
+	out, err := kubectl(ctx, "get", "nodes", "-o", `jsonpath={range .items[*]}`+field+`{"\n"}{end}`)
+	if nil != err {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); "" != line {
+			counts[line]++
+		}
+	}
+	return counts, nil
+}
+
+// NodeArchitectures returns how many nodes of the cluster run each
+// architecture, e.g. {"amd64": 3, "arm64": 1}.
+func NodeArchitectures(ctx context.Context) (map[string]int, error) {
+	return countNodes(ctx, `{.metadata.labels.kubernetes\.io/arch}`)
+}
+
+// NodeContainerRuntimes returns how many nodes of the cluster run each
+// container runtime version, e.g. {"containerd://1.6.8": 3}.
+func NodeContainerRuntimes(ctx context.Context) (map[string]int, error) {
+	return countNodes(ctx, "{.status.nodeInfo.containerRuntimeVersion}")
+}
+
+// RequireNodeRuntime returns an error if a node of the cluster runs a
+// container runtime not starting with prefix, e.g. "containerd://".
+func RequireNodeRuntime(prefix string) error {
+	runtimes, err := NodeContainerRuntimes(context.Background())
+	if nil != err {
+		return err
+	}
+	var others []string
+	for runtime, count := range runtimes {
+		if !strings.HasPrefix(runtime, prefix) {
+			others = append(others, fmt.Sprintf("%s (%d nodes)", runtime, count))
+		}
+	}
+	if len(others) > 0 {
+		sort.Strings(others)
+		return fmt.Errorf("nodes run container runtimes other than '%s': %s", prefix, strings.Join(others, ", "))
+	}
+	return nil
+}
+
+// ClusterResourceUsage returns the CPU and memory used by each node of the
+// cluster, as reported by `kubectl top nodes`, keyed by <node>/cpu and
+// <node>/memory, e.g. {"node-1/cpu": "250m", "node-1/memory": "1024Mi"}. It
+// requires metrics-server to run in the cluster.
+func ClusterResourceUsage(ctx context.Context) (map[string]string, error) {
+	out, err := kubectl(ctx, "top", "nodes", "--no-headers")
+	if nil != err {
+		if strings.Contains(err.Error(), "Metrics API not available") || strings.Contains(err.Error(), "metrics not available") {
+			return nil, fmt.Errorf("node metrics are unavailable, is metrics-server installed? %v", err)
+		}
+		return nil, err
+	}
+	usage := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		// NAME CPU(cores) CPU% MEMORY(bytes) MEMORY%
+		fields := strings.Fields(line)
+		if 0 == len(fields) {
+			continue
+		}
+		if 5 != len(fields) {
+			return nil, fmt.Errorf("failed parsing kubectl top output '%s'", line)
+		}
+		usage[fields[0]+"/cpu"] = fields[1]
+		usage[fields[0]+"/memory"] = fields[3]
+	}
+	return usage, nil
+}
+
+// PickNode returns the node at index, modulo the number of nodes, in the
+// sorted list of the node names of the cluster, so that tests can pin their
+// workloads to nodes reproducibly. The node list is read once per run.
+func PickNode(ctx context.Context, index int) (string, error) {
+	out, err := cachedCluster("nodes", func() (string, error) {
+		out, err := kubectl(ctx, "get", "nodes", "-o", `jsonpath={range .items[*]}{.metadata.name}{"\n"}{end}`)
+		if nil != err {
+			return "", err
+		}
+		names := strings.Fields(out)
+		if 0 == len(names) {
+			return "", fmt.Errorf("no node in the cluster")
+		}
+		sort.Strings(names)
+		return strings.Join(names, "\n"), nil
+	})
+	if nil != err {
+		return "", err
+	}
+	names := strings.Split(out, "\n")
+	return names[(index%len(names)+len(names))%len(names)], nil
+}
+
+// CordonNode marks the node unschedulable, and returns a function making it
+// schedulable again, which callers should defer.
+func CordonNode(ctx context.Context, node string) (uncordon func(ctx context.Context) error, err error) {
+	if _, err = kubectl(ctx, "cordon", node); nil != err {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		_, err := kubectl(ctx, "uncordon", node)
+		return err
+	}, nil
+}
+
+// DrainOptions are the options of DrainNode.
+type DrainOptions struct {
+	IgnoreDaemonSets   bool          // Evict the pods other than the ones of DaemonSets
+	DeleteEmptyDirData bool          // Evict the pods using emptyDir volumes, losing their data
+	GracePeriod        time.Duration // Termination grace period of the pods, 0 uses the one of each pod
+}
+
+// DrainNode cordons the node and evicts its pods, within the wait timeout, see
+// -timeout.wait. Callers can uncordon the node with the function returned by
+// CordonNode.
+func DrainNode(ctx context.Context, node string, opts DrainOptions) error {
+	args := []string{"drain", node, "--timeout=" + timeoutFor(waitClass).String()}
+	if opts.IgnoreDaemonSets {
+		args = append(args, "--ignore-daemonsets")
+	}
+	if opts.DeleteEmptyDirData {
+		args = append(args, "--delete-emptydir-data")
+	}
+	if opts.GracePeriod > 0 {
+		// Round up, as kubectl takes whole seconds and 0 means deleting pods at once
+		args = append(args, fmt.Sprintf("--grace-period=%d", int(math.Ceil(opts.GracePeriod.Seconds()))))
+	}
+	if _, err := kubectl(ctx, args...); nil != err {
+		return fmt.Errorf("failed draining node %s: %v", node, err)
+	}
+	return nil
+}
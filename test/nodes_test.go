@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodeArchitectures(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		want map[string]int
+	}{
+		{"homogeneous", "amd64\namd64\namd64\n", map[string]int{"amd64": 3}},
+		{"mixed", "amd64\narm64\namd64\n", map[string]int{"amd64": 2, "arm64": 1}},
+	} {
+		f, restore := useFakeRunner(fakeResult{out: tc.out})
+		got, err := NodeArchitectures(context.Background())
+		restore()
+		if nil != err || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v (error: %v), want %v", tc.name, got, err, tc.want)
+		}
+		want := `kubectl get nodes -o jsonpath={range .items[*]}{.metadata.labels.kubernetes\.io/arch}{"\n"}{end}`
+		if want != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], want)
+		}
+	}
+}
+
+func TestNodeContainerRuntimes(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		want map[string]int
+	}{
+		{"homogeneous", "containerd://1.6.8\ncontainerd://1.6.8\n", map[string]int{"containerd://1.6.8": 2}},
+		{"mixed", "containerd://1.6.8\ncri-o://1.25.1\ncontainerd://1.6.8\n", map[string]int{"containerd://1.6.8": 2, "cri-o://1.25.1": 1}},
+	} {
+		f, restore := useFakeRunner(fakeResult{out: tc.out})
+		got, err := NodeContainerRuntimes(context.Background())
+		restore()
+		if nil != err || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v (error: %v), want %v", tc.name, got, err, tc.want)
+		}
+		want := `kubectl get nodes -o jsonpath={range .items[*]}{.status.nodeInfo.containerRuntimeVersion}{"\n"}{end}`
+		if want != f.calls[0].String() {
+			t.Errorf("%s: got command '%s', want '%s'", tc.name, f.calls[0], want)
+		}
+	}
+}
+
+func TestRequireNodeRuntime(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{out: "containerd://1.6.8\ncri-o://1.25.1\ncontainerd://1.6.8\n"})
+	defer restore()
+
+	if err := RequireNodeRuntime("c"); nil != err {
+		t.Errorf("Expected every runtime to match 'c', got %v", err)
+	}
+	err := RequireNodeRuntime("containerd://")
+	if nil == err || !strings.Contains(err.Error(), "cri-o://1.25.1 (1 nodes)") {
+		t.Errorf("Expected an error naming the CRI-O nodes, got %v", err)
+	}
+}
+
+func TestClusterResourceUsage(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: `gke-knative-e2e-default-pool-1a2b3c4d-x7k2   254m   13%   1893Mi   67%
+gke-knative-e2e-default-pool-1a2b3c4d-q4wz   98m    5%    1204Mi   42%`})
+	defer restore()
+
+	got, err := ClusterResourceUsage(context.Background())
+	want := map[string]string{
+		"gke-knative-e2e-default-pool-1a2b3c4d-x7k2/cpu":    "254m",
+		"gke-knative-e2e-default-pool-1a2b3c4d-x7k2/memory": "1893Mi",
+		"gke-knative-e2e-default-pool-1a2b3c4d-q4wz/cpu":    "98m",
+		"gke-knative-e2e-default-pool-1a2b3c4d-q4wz/memory": "1204Mi",
+	}
+	if nil != err || !reflect.DeepEqual(want, got) {
+		t.Errorf("ClusterResourceUsage() = %v, %v, want %v", got, err, want)
+	}
+	if want := "kubectl top nodes --no-headers"; want != f.calls[0].String() {
+		t.Errorf("Got command '%s', want '%s'", f.calls[0], want)
+	}
+}
+
+func TestClusterResourceUsageNoMetrics(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{err: exitErr(1, "error: Metrics API not available")})
+	defer restore()
+
+	if _, err := ClusterResourceUsage(context.Background()); nil == err || !strings.Contains(err.Error(), "metrics-server") {
+		t.Errorf("Expected an error pointing to metrics-server, got %v", err)
+	}
+}
+
+func TestPickNode(t *testing.T) {
+	resetClusterCache()
+	defer resetClusterCache()
+	f, restore := useFakeRunner(fakeResult{out: "node-c\nnode-a\nnode-b\n"})
+	defer restore()
+
+	for _, tc := range []struct {
+		index int
+		want  string
+	}{
+		{0, "node-a"},
+		{2, "node-c"},
+		{3, "node-a"},
+		{-1, "node-c"},
+	} {
+		if got, err := PickNode(context.Background(), tc.index); nil != err || tc.want != got {
+			t.Errorf("PickNode(%d) = '%s', %v, want '%s'", tc.index, got, err, tc.want)
+		}
+	}
+	if 1 != len(f.calls) {
+		t.Errorf("Expected the nodes to be listed once, got %v", f.commands())
+	}
+}
+
+func TestPickNodeEmptyCluster(t *testing.T) {
+	resetClusterCache()
+	defer resetClusterCache()
+	_, restore := useFakeRunner(fakeResult{out: ""})
+	defer restore()
+
+	if got, err := PickNode(context.Background(), 0); nil == err {
+		t.Errorf("Expected an error for a cluster without nodes, got '%s'", got)
+	}
+}
+
+func TestCordonNode(t *testing.T) {
+	f, restore := useFakeRunner()
+	defer restore()
+
+	uncordon, err := CordonNode(context.Background(), "node-a")
+	if nil != err {
+		t.Fatalf("Failed cordoning the node: %v", err)
+	}
+	if err = uncordon(context.Background()); nil != err {
+		t.Errorf("Failed uncordoning the node: %v", err)
+	}
+	if want := []string{"kubectl cordon node-a", "kubectl uncordon node-a"}; !reflect.DeepEqual(want, f.commands()) {
+		t.Errorf("Got commands %v, want %v", f.commands(), want)
+	}
+}
+
+func TestDrainNode(t *testing.T) {
+	defer saveFlags()()
+	Flags.WaitTimeout = 5 * time.Minute
+	for _, tc := range []struct {
+		opts DrainOptions
+		want string
+	}{
+		{DrainOptions{}, "kubectl drain node-a --timeout=5m0s"},
+		{DrainOptions{IgnoreDaemonSets: true, DeleteEmptyDirData: true, GracePeriod: 30 * time.Second},
+			"kubectl drain node-a --timeout=5m0s --ignore-daemonsets --delete-emptydir-data --grace-period=30"},
+		{DrainOptions{GracePeriod: 500 * time.Millisecond}, "kubectl drain node-a --timeout=5m0s --grace-period=1"},
+		{DrainOptions{GracePeriod: 1500 * time.Millisecond}, "kubectl drain node-a --timeout=5m0s --grace-period=2"},
+	} {
+		f, restore := useFakeRunner()
+		err := DrainNode(context.Background(), "node-a", tc.opts)
+		restore()
+		if nil != err || tc.want != f.calls[0].String() {
+			t.Errorf("%+v: got command '%s' (error: %v), want '%s'", tc.opts, f.calls[0], err, tc.want)
+		}
+	}
+}
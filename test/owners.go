@@ -0,0 +1,49 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import "sync"
+
+var (
+	ownersMu sync.Mutex
+	owners   = map[string]string{}
+)
+
+// RegisterOwner declares owner as the owner of the test testName.
+func RegisterOwner(testName, owner string) {
+	ownersMu.Lock()
+	defer ownersMu.Unlock()
+	owners[testName] = owner
+}
+
+// Owners returns the owner of every registered test, keyed by test name, for
+// reports of the run.
+func Owners() map[string]string {
+	ownersMu.Lock()
+	defer ownersMu.Unlock()
+	m := make(map[string]string, len(owners))
+	for k, v := range owners {
+		m[k] = v
+	}
+	return m
+}
+
+// ShouldRunForOwner tells whether a test owned by testOwner runs, which it
+// does unless -owner is set to another owner.
+func ShouldRunForOwner(testOwner string) bool {
+	return "" == Flags.Owner || Flags.Owner == testOwner
+}
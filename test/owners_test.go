@@ -0,0 +1,57 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShouldRunForOwner(t *testing.T) {
+	defer saveFlags()()
+	for _, tc := range []struct {
+		flag, owner string
+		want        bool
+	}{
+		{"", "serving-wg", true},
+		{"", "", true},
+		{"serving-wg", "serving-wg", true},
+		{"serving-wg", "eventing-wg", false},
+		{"serving-wg", "", false},
+	} {
+		Flags.Owner = tc.flag
+		if got := ShouldRunForOwner(tc.owner); tc.want != got {
+			t.Errorf("ShouldRunForOwner(%q) with -owner=%q = %v, want %v", tc.owner, tc.flag, got, tc.want)
+		}
+	}
+}
+
+func TestRegisterOwner(t *testing.T) {
+	defer func() { owners = map[string]string{} }()
+	RegisterOwner("TestHelloWorld", "serving-wg")
+	RegisterOwner("TestBrokerTrigger", "eventing-wg")
+
+	want := map[string]string{"TestHelloWorld": "serving-wg", "TestBrokerTrigger": "eventing-wg"}
+	got := Owners()
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Owners() = %v, want %v", got, want)
+	}
+	got["TestHelloWorld"] = "docs-wg"
+	if "serving-wg" != Owners()["TestHelloWorld"] {
+		t.Error("Expected Owners() to return a copy")
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// StartProfiling starts writing a CPU profile to -harnesscpuprofile, and
+// returns a function stopping it and writing a heap profile to
+// -harnessmemprofile. Both are no-ops when their flag isn't set. TestMain
+// should call stop once the tests ran.
+func StartProfiling() (stop func(), err error) {
+	var cpuFile *os.File
+	if "" != Flags.CPUProfile {
+		if cpuFile, err = os.Create(Flags.CPUProfile); nil != err {
+			return nil, err
+		}
+		if err = pprof.StartCPUProfile(cpuFile); nil != err {
+			cpuFile.Close()
+			return nil, err
+		}
+	}
+	return func() {
+		if nil != cpuFile {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if "" != Flags.MemProfile {
+			if err := writeHeapProfile(Flags.MemProfile); nil != err {
+				log.Printf("Failed writing heap profile to %s: %v", Flags.MemProfile, err)
+			}
+		}
+	}, nil
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+	runtime.GC() // get up-to-date statistics
+	return pprof.WriteHeapProfile(f)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartProfiling(t *testing.T) {
+	defer saveFlags()()
+	dir, err := ioutil.TempDir("", "profile")
+	if nil != err {
+		t.Fatalf("Failed creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	Flags.CPUProfile = filepath.Join(dir, "cpu.pprof")
+	Flags.MemProfile = filepath.Join(dir, "mem.pprof")
+
+	stop, err := StartProfiling()
+	if nil != err {
+		t.Fatalf("Failed starting profiling: %v", err)
+	}
+	stop()
+	for _, path := range []string{Flags.CPUProfile, Flags.MemProfile} {
+		if fi, err := os.Stat(path); nil != err || 0 == fi.Size() {
+			t.Errorf("Expected a non-empty profile at %s (error: %v)", path, err)
+		}
+	}
+}
+
+func TestStartProfilingNoop(t *testing.T) {
+	defer saveFlags()()
+	Flags.CPUProfile = ""
+	Flags.MemProfile = ""
+	dir, err := ioutil.TempDir("", "profile")
+	if nil != err {
+		t.Fatalf("Failed creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	stop, err := StartProfiling()
+	if nil != err {
+		t.Fatalf("Failed starting profiling: %v", err)
+	}
+	stop()
+	if files, _ := ioutil.ReadDir(dir); 0 != len(files) {
+		t.Errorf("Expected no profile file, got %d files", len(files))
+	}
+}
@@ -0,0 +1,29 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+// CheckPrereqs runs the prerequisite checks in order and stops at the first
+// failing one, whose error is returned. When -skiponunmet is set, skip is
+// also true so the caller can t.Skip with the error as the reason.
+func CheckPrereqs(checks ...func() error) (skip bool, err error) {
+	for _, check := range checks {
+		if err = check(); nil != err {
+			return Flags.SkipOnUnmetPrereqs, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPrereqs(t *testing.T) {
+	defer saveFlags()()
+	pass := func() error { return nil }
+	fail := func() error { return errors.New("not enough nodes") }
+
+	for _, tc := range []struct {
+		name     string
+		skipMode bool
+		checks   []func() error
+		wantSkip bool
+		wantErr  bool
+	}{
+		{"fail mode, all pass", false, []func() error{pass, pass}, false, false},
+		{"fail mode, one fails", false, []func() error{pass, fail}, false, true},
+		{"skip mode, all pass", true, []func() error{pass, pass}, false, false},
+		{"skip mode, one fails", true, []func() error{pass, fail}, true, true},
+	} {
+		Flags.SkipOnUnmetPrereqs = tc.skipMode
+		skip, err := CheckPrereqs(tc.checks...)
+		if skip != tc.wantSkip || (nil != err) != tc.wantErr {
+			t.Errorf("%s: got skip=%v err=%v, want skip=%v err=%v", tc.name, skip, err, tc.wantSkip, tc.wantErr)
+		}
+	}
+}
+
+func TestCheckPrereqsStopsAtFirstFailure(t *testing.T) {
+	defer saveFlags()()
+	Flags.SkipOnUnmetPrereqs = false
+	called := false
+	_, err := CheckPrereqs(
+		func() error { return errors.New("feature gate disabled") },
+		func() error { called = true; return nil },
+	)
+	if nil == err || called {
+		t.Errorf("Expected first failure to be returned without running later checks, got err=%v called=%v", err, called)
+	}
+}
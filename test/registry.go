@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// nextLink matches the next page of a paginated registry API response.
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// registryHost returns the host of the registry of -dockerrepo.
+func registryHost() string {
+	return strings.SplitN(Flags.DockerRepo, "/", 2)[0]
+}
+
+// registryURL returns the URL of the registry API path, over plain HTTP for
+// local registries like docker does.
+func registryURL(host, path string) string {
+	scheme := "https"
+	if strings.HasPrefix(host, "localhost") || strings.HasPrefix(host, "127.0.0.1") {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, host, path)
+}
+
+// registryCreds is the content of -registrycredsfile, either a docker
+// config.json or simple credentials.
+type registryCreds struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auths    map[string]struct {
+		Auth     string `json:"auth"` // base64 of username:password
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+}
+
+// LoadRegistryCreds returns the credentials of the registry of -dockerrepo
+// read from -registrycredsfile, or empty ones if the flag isn't set, in which
+// case the ambient credentials should be used.
+func LoadRegistryCreds() (username, password string, err error) {
+	if "" == Flags.RegistryCredsFile {
+		return "", "", nil
+	}
+	content, err := ioutil.ReadFile(Flags.RegistryCredsFile)
+	if nil != err {
+		return "", "", fmt.Errorf("failed reading registry credentials: %v", err)
+	}
+	var creds registryCreds
+	if err = json.Unmarshal(content, &creds); nil != err {
+		return "", "", fmt.Errorf("failed parsing registry credentials file '%s': %v", Flags.RegistryCredsFile, err)
+	}
+	if nil == creds.Auths {
+		if "" == creds.Username {
+			return "", "", fmt.Errorf("no username in registry credentials file '%s'", Flags.RegistryCredsFile)
+		}
+		return creds.Username, creds.Password, nil
+	}
+	host := registryHost()
+	for registry, auth := range creds.Auths {
+		if host != strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://"), "/") {
+			continue
+		}
+		if "" == auth.Auth {
+			return auth.Username, auth.Password, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		kv := strings.SplitN(string(decoded), ":", 2)
+		if nil != err || 2 != len(kv) {
+			return "", "", fmt.Errorf("malformed auth of registry '%s' in '%s'", registry, Flags.RegistryCredsFile)
+		}
+		return kv[0], kv[1], nil
+	}
+	return "", "", fmt.Errorf("no credentials of registry '%s' in '%s'", host, Flags.RegistryCredsFile)
+}
+
+// ListRegistryRepos returns the paths of all the repositories of the registry
+// of -dockerrepo, read from its _catalog endpoint page by page.
+func ListRegistryRepos(ctx context.Context) ([]string, error) {
+	username, password, err := LoadRegistryCreds()
+	if nil != err {
+		return nil, err
+	}
+	next := registryURL(registryHost(), "/v2/_catalog?n=100")
+	var repos []string
+	for "" != next {
+		req, err := http.NewRequest(http.MethodGet, next, nil)
+		if nil != err {
+			return nil, err
+		}
+		if "" != username {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if nil != err {
+			return nil, err
+		}
+		var catalog struct {
+			Repositories []string `json:"repositories"`
+		}
+		if http.StatusOK != resp.StatusCode {
+			err = fmt.Errorf("listing repositories at %s returned %s", next, resp.Status)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&catalog)
+		}
+		resp.Body.Close()
+		if nil != err {
+			return nil, err
+		}
+		repos = append(repos, catalog.Repositories...)
+
+		next = ""
+		if m := nextLink.FindStringSubmatch(resp.Header.Get("Link")); nil != m {
+			link, err := req.URL.Parse(m[1]) // usually relative to the registry
+			if nil != err {
+				return nil, fmt.Errorf("invalid next page link '%s': %v", m[1], err)
+			}
+			next = link.String()
+		}
+	}
+	return repos, nil
+}
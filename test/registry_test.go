@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListRegistryRepos(t *testing.T) {
+	defer saveFlags()()
+	pages := map[string]string{
+		"":                `{"repositories":["knative-samples/helloworld-go","knative-samples/helloworld-java"]}`,
+		"helloworld-java": `{"repositories":["knative-samples/helloworld-python","other/app"]}`,
+	}
+	for _, paginated := range []bool{false, true} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if "/v2/_catalog" != r.URL.Path {
+				http.NotFound(w, r)
+				return
+			}
+			last := strings.TrimPrefix(r.URL.Query().Get("last"), "knative-samples/")
+			if !paginated {
+				fmt.Fprint(w, `{"repositories":["knative-samples/helloworld-go","knative-samples/helloworld-java",`+
+					`"knative-samples/helloworld-python","other/app"]}`)
+				return
+			}
+			if "" == last {
+				w.Header().Set("Link", `</v2/_catalog?last=knative-samples/helloworld-java&n=2>; rel="next"`)
+			}
+			fmt.Fprint(w, pages[last])
+		}))
+		Flags.DockerRepo = strings.TrimPrefix(ts.URL, "http://") + "/knative-samples"
+		got, err := ListRegistryRepos(context.Background())
+		ts.Close()
+
+		want := []string{"knative-samples/helloworld-go", "knative-samples/helloworld-java", "knative-samples/helloworld-python", "other/app"}
+		if nil != err || !reflect.DeepEqual(got, want) {
+			t.Errorf("paginated=%v: got %v (error: %v), want %v", paginated, got, err, want)
+		}
+	}
+}
+
+func TestListRegistryReposError(t *testing.T) {
+	defer saveFlags()()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+	Flags.DockerRepo = strings.TrimPrefix(ts.URL, "http://")
+
+	if _, err := ListRegistryRepos(context.Background()); nil == err || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestLoadRegistryCreds(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	dir, err := ioutil.TempDir("", "creds-")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"simple", `{"username": "_json_key", "password": "secret"}`},
+		// base64 of _json_key:secret
+		{"docker config", `{"auths": {"https://gcr.io": {"auth": "X2pzb25fa2V5OnNlY3JldA=="}, "docker.io": {"auth": "b3RoZXI6b3RoZXI="}}}`},
+	} {
+		Flags.RegistryCredsFile = filepath.Join(dir, tc.name+".json")
+		if err = ioutil.WriteFile(Flags.RegistryCredsFile, []byte(tc.content), 0600); nil != err {
+			t.Fatal(err)
+		}
+		if username, password, err := LoadRegistryCreds(); nil != err || "_json_key" != username || "secret" != password {
+			t.Errorf("%s: LoadRegistryCreds() = '%s', '%s', %v, want '_json_key', 'secret'", tc.name, username, password, err)
+		}
+	}
+
+	Flags.RegistryCredsFile = filepath.Join(dir, "missing.json")
+	if _, _, err = LoadRegistryCreds(); nil == err || !strings.Contains(err.Error(), "missing.json") {
+		t.Errorf("Expected an error naming the missing file, got %v", err)
+	}
+	Flags.RegistryCredsFile = ""
+	if username, password, err := LoadRegistryCreds(); nil != err || "" != username || "" != password {
+		t.Errorf("Expected no credentials without -registrycredsfile, got '%s', '%s', %v", username, password, err)
+	}
+}
+
+func TestListRegistryReposCreds(t *testing.T) {
+	defer saveFlags()()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || "_json_key" != username || "secret" != password {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"repositories":["knative-samples/helloworld-go"]}`)
+	}))
+	defer ts.Close()
+	f, err := ioutil.TempFile("", "creds-")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"username": "_json_key", "password": "secret"}`)
+	f.Close()
+	Flags.DockerRepo = strings.TrimPrefix(ts.URL, "http://")
+	Flags.RegistryCredsFile = f.Name()
+
+	if got, err := ListRegistryRepos(context.Background()); nil != err || 1 != len(got) {
+		t.Errorf("Expected the credentials to be sent, got %v (error: %v)", got, err)
+	}
+}
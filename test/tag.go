@@ -0,0 +1,167 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	tagPlaceholder = regexp.MustCompile(`{[^{}]*}`)
+	validTag       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+	invalidTagChar = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// tagTemplateVars are the placeholders -tagtemplate supports, with their
+// default values.
+func tagTemplateVars() map[string]string {
+	return map[string]string{
+		"lang":  "",
+		"sha":   os.Getenv("PULL_BASE_SHA"), // set by Prow
+		"runid": os.Getenv("BUILD_ID"),      // set by Prow
+		"date":  time.Now().UTC().Format("20060102"),
+	}
+}
+
+// RenderTag substitutes the {lang}, {sha}, {runid} and {date} placeholders of
+// -tagtemplate with vars, or their defaults from the environment, and returns
+// an error unless the result is a valid image tag.
+func RenderTag(vars map[string]string) (string, error) {
+	return renderTag(Flags.TagTemplate, vars)
+}
+
+func renderTag(template string, vars map[string]string) (string, error) {
+	values := tagTemplateVars()
+	for k, v := range vars {
+		if _, ok := values[k]; !ok {
+			return "", fmt.Errorf("unknown tag template variable '%s'", k)
+		}
+		values[k] = v
+	}
+	var err error
+	tag := tagPlaceholder.ReplaceAllStringFunc(template, func(p string) string {
+		v, ok := values[p[1:len(p)-1]]
+		if !ok && nil == err {
+			err = fmt.Errorf("unknown placeholder %s in tag template '%s'", p, template)
+		}
+		return v
+	})
+	if nil != err {
+		return "", err
+	}
+	if !validTag.MatchString(tag) {
+		return "", fmt.Errorf("tag template '%s' renders invalid tag '%s'", template, tag)
+	}
+	return tag, nil
+}
+
+// ApplyBranchTag sets -tag to the current git branch, sanitized into a valid
+// tag, when -usebranchtag is set and -tag isn't set on the command line. It
+// keeps the default tag if the branch can't be resolved. It must be called
+// after the flags are parsed.
+func ApplyBranchTag() {
+	applyBranchTag(flag.CommandLine)
+}
+
+func applyBranchTag(fs *flag.FlagSet) {
+	if !Flags.UseBranchTag {
+		return
+	}
+	explicit := false
+	fs.Visit(func(f *flag.Flag) { explicit = explicit || "tag" == f.Name })
+	if explicit {
+		return
+	}
+	branch, err := runCommand(context.Background(), nil, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if nil == err && "HEAD" == branch {
+		err = fmt.Errorf("HEAD is detached")
+	}
+	tag := invalidTagChar.ReplaceAllString(branch, "-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	if nil == err && !validTag.MatchString(tag) {
+		err = fmt.Errorf("branch '%s' makes invalid tag '%s'", branch, tag)
+	}
+	if nil != err {
+		log.Printf("Warning: failed resolving the git branch, using tag '%s': %v", Flags.Tag, err)
+		return
+	}
+	fs.Set("tag", tag)
+}
+
+// imageTag returns the tag of the images of language, empty for images not
+// specific to a language, rendered from -tagtemplate if set, or -tag.
+func (f *EnvironmentFlags) imageTag(language string) (string, error) {
+	if "" == f.TagTemplate {
+		return f.Tag, nil
+	}
+	return renderTag(f.TagTemplate, map[string]string{"lang": language})
+}
+
+// mustImageTag is imageTag for ImagePath, which can't return errors. It exits
+// the test binary if the tag can't be rendered rather than using another tag,
+// Validate reports the templates not rendering for the languages under test.
+func mustImageTag(language string) string {
+	tag, err := Flags.imageTag(language)
+	if nil != err {
+		log.Fatalf("Failed resolving the tag of the %s images: %v", language, err)
+	}
+	return tag
+}
+
+// tagLanguages returns the languages -tagtemplate must render a valid tag for:
+// the whitelisted ones, or the known ones if none is. A template using {lang}
+// is rendered with a sample language when there's none, so that its other
+// placeholders are still checked.
+func (f *EnvironmentFlags) tagLanguages() []string {
+	if !strings.Contains(f.TagTemplate, "{lang}") {
+		return []string{""}
+	}
+	var languages []string
+	if "" != f.Languages {
+		languages = strings.Split(f.Languages, ",")
+	} else {
+		languages = KnownLanguages
+	}
+	if 0 == len(languages) {
+		return []string{"lang"}
+	}
+	return languages
+}
+
+// checkImageTags returns an error if the tag of the images of a language under
+// test can't be rendered or is forbidden by -forbidlatest.
+func (f *EnvironmentFlags) checkImageTags() error {
+	for _, language := range f.tagLanguages() {
+		tag, err := f.imageTag(language)
+		if nil == err {
+			err = f.checkTag(tag)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
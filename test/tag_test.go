@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderTag(t *testing.T) {
+	defer saveFlags()()
+	for _, tc := range []struct {
+		template string
+		vars     map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{"{lang}-{sha}", map[string]string{"lang": "go", "sha": "abc123"}, "go-abc123", false},
+		{"{date}", map[string]string{"date": "20191014"}, "20191014", false},
+		{"{lang}-{branch}", map[string]string{"lang": "go"}, "", true},
+		{"{lang}-{sha}", map[string]string{"lang": "go", "sha": "feature/x"}, "", true},
+		{"{lang}", map[string]string{"lang": ""}, "", true},
+		{"{lang}", map[string]string{"branch": "master"}, "", true},
+	} {
+		Flags.TagTemplate = tc.template
+		got, err := RenderTag(tc.vars)
+		if tc.want != got || (nil != err) != tc.wantErr {
+			t.Errorf("RenderTag(%v) with template '%s' = '%s', %v, want '%s' with error=%v",
+				tc.vars, tc.template, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestImagePathTagTemplate(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.Tag = "latest"
+	Flags.TagTemplate = "v1-{runid}"
+	Flags.ForbidLatestTag = true
+
+	saved, ok := os.LookupEnv("BUILD_ID")
+	os.Setenv("BUILD_ID", "1234")
+	defer func() {
+		if ok {
+			os.Setenv("BUILD_ID", saved)
+		} else {
+			os.Unsetenv("BUILD_ID")
+		}
+	}()
+
+	// -forbidlatest only applies to the rendered tag
+	if err := Flags.Validate(); nil != err {
+		t.Errorf("Expected the rendered tag to pass validation, got %v", err)
+	}
+	want := "gcr.io/knative-samples/helloworld-go:v1-1234"
+	if got, err := ResolveImagePath("helloworld-go", "go"); nil != err || want != got {
+		t.Errorf("ResolveImagePath() = '%s', %v, want '%s'", got, err, want)
+	}
+	if got := ImagePath("helloworld-go"); want != got {
+		t.Errorf("ImagePath() = '%s', want '%s'", got, want)
+	}
+
+	Flags.TagTemplate = "{unknown}"
+	if _, err := ResolveImagePath("helloworld-go", "go"); nil == err {
+		t.Error("Expected ResolveImagePath to fail with an invalid template, got nil")
+	}
+	if err := Flags.Validate(); nil == err {
+		t.Error("Expected Validate to fail with an invalid template, got nil")
+	}
+
+	Flags.TagTemplate = "latest"
+	if err := Flags.Validate(); nil == err {
+		t.Error("Expected Validate to forbid a template rendering 'latest', got nil")
+	}
+}
+
+func TestImagePathTagTemplateLanguage(t *testing.T) {
+	defer saveFlags()()
+	Flags.DockerRepo = "gcr.io/knative-samples"
+	Flags.TagTemplate = "{lang}-{sha}"
+	Flags.Languages = "go,java"
+
+	saved, ok := os.LookupEnv("PULL_BASE_SHA")
+	os.Setenv("PULL_BASE_SHA", "abc123")
+	defer func() {
+		if ok {
+			os.Setenv("PULL_BASE_SHA", saved)
+		} else {
+			os.Unsetenv("PULL_BASE_SHA")
+		}
+	}()
+
+	if err := Flags.Validate(); nil != err {
+		t.Errorf("Expected the template to render for every language, got %v", err)
+	}
+	want := "gcr.io/knative-samples/helloworld-go:go-abc123"
+	if got := ComponentImage("helloworld", "go"); want != got {
+		t.Errorf("ComponentImage() = '%s', want '%s'", got, want)
+	}
+	if got, err := ResolveImagePath("helloworld-go", "go"); nil != err || want != got {
+		t.Errorf("ResolveImagePath() = '%s', %v, want '%s'", got, err, want)
+	}
+	if got := ImagePathForLanguage("helloworld-java", "java"); "gcr.io/knative-samples/helloworld-java:java-abc123" != got {
+		t.Errorf("ImagePathForLanguage() = '%s', want the java tag", got)
+	}
+
+	Flags.Languages = "go,.net"
+	if err := Flags.Validate(); nil == err {
+		t.Error("Expected Validate to fail for a language rendering an invalid tag, got nil")
+	}
+}
+
+func TestApplyBranchTag(t *testing.T) {
+	defer saveFlags()()
+	Flags.UseBranchTag = true
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		result fakeResult
+		want   string
+	}{
+		{"branch", nil, fakeResult{out: "main"}, "main"},
+		{"sanitized", nil, fakeResult{out: "feature/scale-to-zero"}, "feature-scale-to-zero"},
+		{"detached", nil, fakeResult{out: "HEAD"}, "latest"},
+		{"git failure", nil, fakeResult{err: exitErr(128, "fatal: not a git repository (or any of the parent directories): .git")}, "latest"},
+		{"explicit tag", []string{"-tag", "v1"}, fakeResult{out: "main"}, "v1"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.StringVar(&Flags.Tag, "tag", "latest", "")
+		if err := fs.Parse(tc.args); nil != err {
+			t.Fatalf("Failed parsing flags: %v", err)
+		}
+		f, restore := useFakeRunner(tc.result)
+		applyBranchTag(fs)
+		restore()
+		if tc.want != Flags.Tag {
+			t.Errorf("%s: got tag '%s', want '%s'", tc.name, Flags.Tag, tc.want)
+		}
+		if 0 == len(tc.args) && "git rev-parse --abbrev-ref HEAD" != strings.Join(f.commands(), "; ") {
+			t.Errorf("%s: got commands %v, want 'git rev-parse --abbrev-ref HEAD'", tc.name, f.commands())
+		}
+		if 0 != len(tc.args) && 0 != len(f.calls) {
+			t.Errorf("%s: expected git not to run, got %v", tc.name, f.commands())
+		}
+	}
+}
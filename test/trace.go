@@ -0,0 +1,91 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// traceEvent is an event of the Chrome trace format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name      string `json:"name"`
+	Phase     string `json:"ph"` // B for begin, E for end
+	Timestamp int64  `json:"ts"` // microseconds
+	PID       int    `json:"pid"`
+	TID       int    `json:"tid"`
+}
+
+// Tracer records the timings of test phases, and writes them to -tracefile in
+// the Chrome trace format. It's a no-op if -tracefile is empty.
+type Tracer struct {
+	mu     sync.Mutex
+	path   string
+	start  time.Time
+	spans  int
+	events []traceEvent
+}
+
+// NewTracer returns a Tracer writing to -tracefile.
+func NewTracer() *Tracer {
+	return &Tracer{path: Flags.TraceFile, start: time.Now()}
+}
+
+// Begin records the start of the phase name, and returns a function recording
+// its end. Every phase gets its own track, so that phases of parallel tests
+// don't need to nest.
+func (t *Tracer) Begin(name string) func() {
+	if "" == t.path {
+		return func() {}
+	}
+	t.mu.Lock()
+	t.spans++
+	tid := t.spans
+	t.events = append(t.events, traceEvent{Name: name, Phase: "B", Timestamp: t.since(), PID: 1, TID: tid})
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.events = append(t.events, traceEvent{Name: name, Phase: "E", Timestamp: t.since(), PID: 1, TID: tid})
+	}
+}
+
+// since returns the microseconds elapsed since the tracer was created.
+func (t *Tracer) since() int64 {
+	return time.Since(t.start).Nanoseconds() / int64(time.Microsecond)
+}
+
+// Flush writes the events recorded so far to -tracefile as a JSON array.
+func (t *Tracer) Flush() error {
+	if "" == t.path {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.events
+	if nil == events {
+		events = []traceEvent{}
+	}
+	content, err := json.Marshal(events)
+	if nil != err {
+		return err
+	}
+	return ioutil.WriteFile(t.path, content, 0644)
+}
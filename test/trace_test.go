@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	defer saveFlags()()
+	dir, err := ioutil.TempDir("", "trace-")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Flags.TraceFile = filepath.Join(dir, "trace.json")
+
+	tracer := NewTracer()
+	endSetup := tracer.Begin("setup")
+	time.Sleep(time.Millisecond)
+	endSetup()
+	endTest := tracer.Begin("TestHelloWorld")
+	endTest()
+	if err = tracer.Flush(); nil != err {
+		t.Fatalf("Failed flushing the trace: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(Flags.TraceFile)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var events []traceEvent
+	if err = json.Unmarshal(content, &events); nil != err {
+		t.Fatalf("Failed parsing trace '%s': %v", content, err)
+	}
+	if 4 != len(events) {
+		t.Fatalf("Got events %+v, want a begin and an end per phase", events)
+	}
+	for i, name := range []string{"setup", "TestHelloWorld"} {
+		begin, end := events[2*i], events[2*i+1]
+		if name != begin.Name || "B" != begin.Phase || name != end.Name || "E" != end.Phase || begin.TID != end.TID {
+			t.Errorf("Got events %+v and %+v, want the begin and end of %s", begin, end, name)
+		}
+		if begin.Timestamp < 0 || end.Timestamp < begin.Timestamp {
+			t.Errorf("%s: got begin at %dus and end at %dus", name, begin.Timestamp, end.Timestamp)
+		}
+	}
+	if d := events[1].Timestamp - events[0].Timestamp; d < 1000 {
+		t.Errorf("Got setup lasting %dus, want at least the 1ms it slept", d)
+	}
+}
+
+func TestTracerNoFile(t *testing.T) {
+	defer saveFlags()()
+	Flags.TraceFile = ""
+
+	tracer := NewTracer()
+	tracer.Begin("setup")()
+	if err := tracer.Flush(); nil != err || 0 != len(tracer.events) {
+		t.Errorf("Expected the tracer to be a no-op, got events %+v (error: %v)", tracer.events, err)
+	}
+}
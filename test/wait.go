@@ -0,0 +1,253 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPollInterval is used by helpers not taking a poll interval.
+const defaultPollInterval = 2 * time.Second
+
+// pollUntil calls condition every interval until it reports done or returns
+// an error, or until ctx is done in which case ctx.Err() is returned.
+func pollUntil(ctx context.Context, interval time.Duration, condition func() (bool, error)) error {
+	for {
+		done, err := condition()
+		if nil != err || done {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pollKubectl runs kubectl with args every interval until done accepts its
+// output, or ctx is done. It returns the last output, and on timeout the
+// context error along with the last kubectl error if any.
+func pollKubectl(ctx context.Context, interval time.Duration, done func(out string) bool, args ...string) (string, error) {
+	var out string
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		out, lastErr = kubectl(ctx, args...)
+		return nil == lastErr && done(out), nil
+	})
+	if nil != err && nil != lastErr {
+		err = fmt.Errorf("%v (last error: %v)", err, lastErr)
+	}
+	return out, err
+}
+
+// Retry calls fn every interval until it succeeds, and returns the last error
+// of fn if ctx is done first. A ctx without deadline is bounded by the wait
+// timeout, see -timeout.wait.
+func Retry(ctx context.Context, interval time.Duration, fn func() error) error {
+	if _, ok := ctx.Deadline(); !ok {
+		if timeout := timeoutFor(waitClass); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		lastErr = fn()
+		return nil == lastErr, nil
+	})
+	if nil != err && nil != lastErr {
+		return lastErr
+	}
+	return err
+}
+
+// WaitForScaleToZero polls the deployment every interval until it has no
+// replicas left, or ctx is done.
+func WaitForScaleToZero(ctx context.Context, namespace, deployment string, interval time.Duration) error {
+	var replicas string
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		replicas, lastErr = kubectl(ctx, "get", "deploy", deployment, "-n", namespace, "-o", "jsonpath={.status.replicas}")
+		return nil == lastErr && ("" == replicas || "0" == replicas), nil
+	})
+	if nil != err {
+		return fmt.Errorf("deployment %s/%s did not scale to zero (replicas: '%s', last error: %v): %v",
+			namespace, deployment, replicas, lastErr, err)
+	}
+	return nil
+}
+
+// WaitForServiceAddress polls the LoadBalancer Service every interval until
+// it has an external IP or hostname, and returns it.
+func WaitForServiceAddress(ctx context.Context, namespace, service string, interval time.Duration) (string, error) {
+	var address string
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		address, lastErr = kubectl(ctx, "get", "svc", service, "-n", namespace, "-o",
+			"jsonpath={.status.loadBalancer.ingress[0].ip}{.status.loadBalancer.ingress[0].hostname}")
+		return nil == lastErr && "" != address, nil
+	})
+	if nil != err {
+		return "", fmt.Errorf("service %s/%s has no external address (last error: %v): %v", namespace, service, lastErr, err)
+	}
+	return address, nil
+}
+
+// ScaleDeployment scales the deployment to replicas, then polls it every
+// interval until that many replicas are ready, or ctx is done.
+func ScaleDeployment(ctx context.Context, namespace, deployment string, replicas int, interval time.Duration) error {
+	if _, err := kubectl(ctx, "scale", "deploy/"+deployment, "--replicas="+strconv.Itoa(replicas), "-n", namespace); nil != err {
+		return err
+	}
+	want := strconv.Itoa(replicas)
+	var ready string
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		ready, lastErr = kubectl(ctx, "get", "deploy", deployment, "-n", namespace, "-o", "jsonpath={.status.readyReplicas}")
+		if "" == ready && nil == lastErr {
+			// readyReplicas is omitted when there's none
+			ready = "0"
+		}
+		return nil == lastErr && want == ready, nil
+	})
+	if nil != err {
+		return fmt.Errorf("deployment %s/%s has %s ready replicas, want %d (last error: %v): %v",
+			namespace, deployment, ready, replicas, lastErr, err)
+	}
+	return nil
+}
+
+// WaitForEvent polls the events of the namespace every interval until one
+// with reason was emitted for the object named involvedObject, or ctx is done.
+func WaitForEvent(ctx context.Context, namespace, involvedObject, reason string, interval time.Duration) error {
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		var out string
+		out, lastErr = kubectl(ctx, "get", "events", "-n", namespace,
+			"--field-selector=reason="+reason+",involvedObject.name="+involvedObject, "-o", "json")
+		if nil != lastErr {
+			return false, nil
+		}
+		var events struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if lastErr = json.Unmarshal([]byte(out), &events); nil != lastErr {
+			return false, nil
+		}
+		return len(events.Items) > 0, nil
+	})
+	if nil != err {
+		return fmt.Errorf("no event '%s' for %s/%s (last error: %v): %v", reason, namespace, involvedObject, lastErr, err)
+	}
+	return nil
+}
+
+// WaitForPVCBound polls the PersistentVolumeClaim every interval until it's
+// Bound, or fails if it's Lost or ctx is done, reporting its phase.
+func WaitForPVCBound(ctx context.Context, namespace, pvc string, interval time.Duration) error {
+	var phase string
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		phase, lastErr = kubectl(ctx, "get", "pvc", pvc, "-n", namespace, "-o", "jsonpath={.status.phase}")
+		if nil == lastErr && "Lost" == phase {
+			return false, fmt.Errorf("claim is Lost")
+		}
+		return nil == lastErr && "Bound" == phase, nil
+	})
+	if nil != err {
+		return fmt.Errorf("pvc %s/%s is not bound (phase: '%s', last error: %v): %v", namespace, pvc, phase, lastErr, err)
+	}
+	return nil
+}
+
+// WaitForHPAReplicas polls the HorizontalPodAutoscaler every interval until it
+// scaled to want replicas, or ctx is done.
+func WaitForHPAReplicas(ctx context.Context, namespace, hpa string, want int, interval time.Duration) error {
+	current, err := pollKubectl(ctx, interval, func(out string) bool { return strconv.Itoa(want) == out },
+		"get", "hpa", hpa, "-n", namespace, "-o", "jsonpath={.status.currentReplicas}")
+	if nil != err {
+		return fmt.Errorf("hpa %s/%s has %s replicas, want %d: %v", namespace, hpa, current, want, err)
+	}
+	return nil
+}
+
+// WaitForDaemonSetReady polls the DaemonSet every interval until a ready pod
+// runs on every node it's scheduled on, or ctx is done.
+func WaitForDaemonSetReady(ctx context.Context, namespace, name string, interval time.Duration) error {
+	status, err := pollKubectl(ctx, interval, func(out string) bool {
+		// The status is empty until the controller first observes the DaemonSet
+		fields := strings.Fields(out)
+		return 2 == len(fields) && fields[0] == fields[1]
+	}, "get", "ds", name, "-n", namespace, "-o", "jsonpath={.status.numberReady} {.status.desiredNumberScheduled}")
+	if nil != err {
+		return fmt.Errorf("daemonset %s/%s is not ready (ready/desired: '%s'): %v", namespace, name, status, err)
+	}
+	return nil
+}
+
+// WaitForJobComplete polls the Job every interval until one of its pods
+// succeeded, or fails once its pods failed more than its backoff limit
+// allows, reporting why, or when ctx is done.
+func WaitForJobComplete(ctx context.Context, namespace, job string, interval time.Duration) error {
+	var status []string
+	var lastErr error
+	err := pollUntil(ctx, interval, func() (bool, error) {
+		var out string
+		out, lastErr = kubectl(ctx, "get", "job", job, "-n", namespace, "-o",
+			`jsonpath={.status.succeeded}|{.status.failed}|{.spec.backoffLimit}|{.status.conditions[?(@.type=="Failed")].reason}`)
+		if nil != lastErr {
+			return false, nil
+		}
+		// Counts are omitted when zero
+		if status = strings.Split(out, "|"); 4 != len(status) {
+			return false, fmt.Errorf("unexpected status '%s'", out)
+		}
+		if succeeded, _ := strconv.Atoi(status[0]); succeeded >= 1 {
+			return true, nil
+		}
+		failed, _ := strconv.Atoi(status[1])
+		if limit, err := strconv.Atoi(status[2]); "" != status[3] || (nil == err && failed > limit) {
+			return false, fmt.Errorf("%d pods failed (reason: '%s')", failed, status[3])
+		}
+		return false, nil
+	})
+	if nil != err {
+		if nil != lastErr {
+			err = fmt.Errorf("%v (last error: %v)", err, lastErr)
+		}
+		return fmt.Errorf("job %s/%s did not complete: %v", namespace, job, err)
+	}
+	return nil
+}
+
+// WaitForEndpointCount polls the Endpoints of the service every interval
+// until exactly want addresses are ready behind it, or ctx is done.
+func WaitForEndpointCount(ctx context.Context, namespace, service string, want int, interval time.Duration) error {
+	out, err := pollKubectl(ctx, interval, func(out string) bool { return want == len(strings.Fields(out)) },
+		"get", "endpoints", service, "-n", namespace, "-o", "jsonpath={.subsets[*].addresses[*].ip}")
+	if nil != err {
+		return fmt.Errorf("service %s/%s has %d ready endpoints, want %d: %v", namespace, service, len(strings.Fields(out)), want, err)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForScaleToZero(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "2"}, fakeResult{out: "1"}, fakeResult{out: "0"})
+	defer restore()
+
+	if err := WaitForScaleToZero(context.Background(), "default", "autoscale-go", time.Millisecond); nil != err {
+		t.Fatalf("Expected scale to zero, got %v", err)
+	}
+	if got := len(f.calls); 3 != got {
+		t.Errorf("Expected 3 polls, got %d", got)
+	}
+	want := "kubectl get deploy autoscale-go -n default -o jsonpath={.status.replicas}"
+	if got := f.calls[0].String(); want != got {
+		t.Errorf("Got command '%s', want '%s'", got, want)
+	}
+}
+
+func TestWaitForScaleToZeroTimeout(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{out: "1"})
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitForScaleToZero(ctx, "default", "autoscale-go", time.Millisecond); nil == err {
+		t.Error("Expected timeout error, got nil")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), time.Millisecond, func() error {
+		if calls++; calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if nil != err || 3 != calls {
+		t.Errorf("Expected success after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	if err = Retry(context.Background(), time.Millisecond, func() error { calls++; return nil }); nil != err || 1 != calls {
+		t.Errorf("Expected immediate success, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	calls := 0
+	err := Retry(ctx, time.Millisecond, func() error {
+		calls++
+		return fmt.Errorf("attempt %d failed", calls)
+	})
+	if nil == err || fmt.Sprintf("attempt %d failed", calls) != err.Error() {
+		t.Errorf("Expected the last error after %d attempts, got %v", calls, err)
+	}
+}
+
+func TestRetryDefaultTimeout(t *testing.T) {
+	defer saveFlags()()
+	Flags.WaitTimeout = 20 * time.Millisecond
+	if err := Retry(context.Background(), time.Millisecond, func() error { return errors.New("never") }); nil == err {
+		t.Error("Expected a timeout with a context without deadline, got nil")
+	}
+}
+
+func TestScaleDeployment(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{}, fakeResult{out: ""}, fakeResult{out: "1"}, fakeResult{out: "3"})
+	defer restore()
+
+	if err := ScaleDeployment(context.Background(), "default", "helloworld-go", 3, time.Millisecond); nil != err {
+		t.Fatalf("Expected 3 ready replicas, got %v", err)
+	}
+	poll := "kubectl get deploy helloworld-go -n default -o jsonpath={.status.readyReplicas}"
+	want := []string{"kubectl scale deploy/helloworld-go --replicas=3 -n default", poll, poll, poll}
+	if got := f.commands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got commands %v, want %v", got, want)
+	}
+}
+
+func TestScaleDeploymentTimeout(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{}, fakeResult{out: "1"})
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ScaleDeployment(ctx, "default", "helloworld-go", 3, time.Millisecond); nil == err {
+		t.Error("Expected timeout error, got nil")
+	}
+}
+
+func TestWaitForEvent(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: `{"items":[]}`},
+		fakeResult{out: `{"items":[{"reason":"Scheduled","involvedObject":{"name":"helloworld-go"}}]}`})
+	defer restore()
+
+	if err := WaitForEvent(context.Background(), "default", "helloworld-go", "Scheduled", time.Millisecond); nil != err {
+		t.Fatalf("Expected the event to be found, got %v", err)
+	}
+	want := "kubectl get events -n default --field-selector=reason=Scheduled,involvedObject.name=helloworld-go -o json"
+	if 2 != len(f.calls) || want != f.calls[0].String() {
+		t.Errorf("Expected 2 polls of '%s', got %v", want, f.commands())
+	}
+}
+
+func TestWaitForEventTimeout(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{out: `{"items":[]}`})
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitForEvent(ctx, "default", "helloworld-go", "Scheduled", time.Millisecond); nil == err {
+		t.Error("Expected timeout error, got nil")
+	}
+}
+
+func TestWaitForPVCBound(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "Pending"}, fakeResult{out: "Bound"})
+	defer restore()
+
+	if err := WaitForPVCBound(context.Background(), "default", "data", time.Millisecond); nil != err {
+		t.Fatalf("Expected the claim to be bound, got %v", err)
+	}
+	if want := "kubectl get pvc data -n default -o jsonpath={.status.phase}"; 2 != len(f.calls) || want != f.calls[0].String() {
+		t.Errorf("Expected 2 polls of '%s', got %v", want, f.commands())
+	}
+}
+
+func TestWaitForPVCBoundFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		phase string
+	}{
+		{"timeout", "Pending"},
+		{"lost", "Lost"},
+	} {
+		_, restore := useFakeRunner(fakeResult{out: tc.phase})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := WaitForPVCBound(ctx, "default", "data", time.Millisecond)
+		cancel()
+		restore()
+		if nil == err || !strings.Contains(err.Error(), "phase: '"+tc.phase+"'") {
+			t.Errorf("%s: expected an error with the phase, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestWaitForHPAReplicas(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "1"}, fakeResult{out: "2"}, fakeResult{out: "4"})
+	defer restore()
+
+	if err := WaitForHPAReplicas(context.Background(), "default", "autoscale-go", 4, time.Millisecond); nil != err {
+		t.Fatalf("Expected 4 replicas, got %v", err)
+	}
+	if want := "kubectl get hpa autoscale-go -n default -o jsonpath={.status.currentReplicas}"; 3 != len(f.calls) || want != f.calls[0].String() {
+		t.Errorf("Expected 3 polls of '%s', got %v", want, f.commands())
+	}
+}
+
+func TestWaitForHPAReplicasTimeout(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{out: "2"})
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitForHPAReplicas(ctx, "default", "autoscale-go", 4, time.Millisecond); nil == err || !strings.Contains(err.Error(), "has 2 replicas") {
+		t.Errorf("Expected timeout error with the current replicas, got %v", err)
+	}
+}
+
+func TestWaitForDaemonSetReady(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: " 3"}, fakeResult{out: "1 3"}, fakeResult{out: "3 3"})
+	defer restore()
+
+	if err := WaitForDaemonSetReady(context.Background(), "kube-system", "fluentd", time.Millisecond); nil != err {
+		t.Fatalf("Expected the daemonset to be ready, got %v", err)
+	}
+	want := "kubectl get ds fluentd -n kube-system -o jsonpath={.status.numberReady} {.status.desiredNumberScheduled}"
+	if 3 != len(f.calls) || want != f.calls[0].String() {
+		t.Errorf("Expected 3 polls of '%s', got %v", want, f.commands())
+	}
+}
+
+func TestWaitForDaemonSetReadyTimeout(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{out: "2 3"})
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitForDaemonSetReady(ctx, "kube-system", "fluentd", time.Millisecond); nil == err {
+		t.Error("Expected timeout error, got nil")
+	}
+}
+
+func TestWaitForJobComplete(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "||6|"}, fakeResult{out: "|1|6|"}, fakeResult{out: "1|1|6|"})
+	defer restore()
+
+	if err := WaitForJobComplete(context.Background(), "default", "pi", time.Millisecond); nil != err {
+		t.Fatalf("Expected the job to complete, got %v", err)
+	}
+	want := `kubectl get job pi -n default -o jsonpath={.status.succeeded}|{.status.failed}|{.spec.backoffLimit}|` +
+		`{.status.conditions[?(@.type=="Failed")].reason}`
+	if 3 != len(f.calls) || want != f.calls[0].String() {
+		t.Errorf("Expected 3 polls of '%s', got %v", want, f.commands())
+	}
+}
+
+func TestWaitForJobCompleteFailure(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: "|1|1|"}, fakeResult{out: "|2|1|BackoffLimitExceeded"})
+	defer restore()
+
+	err := WaitForJobComplete(context.Background(), "default", "pi", time.Millisecond)
+	if nil == err || !strings.Contains(err.Error(), "BackoffLimitExceeded") {
+		t.Errorf("Expected a failure with the reason, got %v", err)
+	}
+	if 2 != len(f.calls) {
+		t.Errorf("Expected polling to stop on failure, got %d polls", len(f.calls))
+	}
+}
+
+func TestWaitForJobCompleteTimeout(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{out: "||6|"})
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitForJobComplete(ctx, "default", "pi", time.Millisecond); nil == err {
+		t.Error("Expected timeout error, got nil")
+	}
+}
+
+func TestWaitForEndpointCount(t *testing.T) {
+	f, restore := useFakeRunner(fakeResult{out: ""}, fakeResult{out: "10.4.0.12"}, fakeResult{out: "10.4.0.12 10.4.1.7 10.4.2.3"})
+	defer restore()
+
+	if err := WaitForEndpointCount(context.Background(), "default", "helloworld-go", 3, time.Millisecond); nil != err {
+		t.Fatalf("Expected 3 endpoints, got %v", err)
+	}
+	if want := "kubectl get endpoints helloworld-go -n default -o jsonpath={.subsets[*].addresses[*].ip}"; 3 != len(f.calls) || want != f.calls[0].String() {
+		t.Errorf("Expected 3 polls of '%s', got %v", want, f.commands())
+	}
+}
+
+func TestWaitForEndpointCountTimeout(t *testing.T) {
+	_, restore := useFakeRunner(fakeResult{out: "10.4.0.12 10.4.1.7"})
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitForEndpointCount(ctx, "default", "helloworld-go", 3, time.Millisecond); nil == err || !strings.Contains(err.Error(), "has 2 ready endpoints") {
+		t.Errorf("Expected timeout error with the current endpoints, got %v", err)
+	}
+}